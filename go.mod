@@ -5,4 +5,5 @@ go 1.13
 require (
 	github.com/google/go-querystring v1.0.0
 	github.com/thanhpk/randstr v1.0.4
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 )
@@ -0,0 +1,304 @@
+package client
+
+import (
+    "context"
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/json"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    certificatesPath = "certificates"
+
+    defaultRefreshInterval = 12 * time.Hour
+    // certificates expiring within this window are refreshed ahead of the regular interval
+    defaultRefreshBeforeExpiry = 24 * time.Hour
+    retryRefreshInterval       = time.Minute
+)
+
+var (
+    ErrNoCertificate = errors.New("wxpay: no platform certificate available")
+    // ErrNoRoots is returned when the certificate chain can not be verified
+    ErrNoRoots = errors.New("wxpay: no root certificate to verify platform certificates")
+)
+
+// Certificate is a decrypted and verified WeChat Pay platform certificate
+type Certificate struct {
+    SerialNo      string
+    EffectiveTime time.Time
+    ExpireTime    time.Time
+    Certificate   *x509.Certificate
+}
+
+// PublicKey returns the RSA public key of the certificate
+func (cert *Certificate) PublicKey() *rsa.PublicKey {
+    key, _ := cert.Certificate.PublicKey.(*rsa.PublicKey)
+    return key
+}
+
+type EncryptCertificate struct {
+    Algorithm      string `json:"algorithm"`
+    Nonce          string `json:"nonce"`
+    AssociatedData string `json:"associated_data"`
+    Ciphertext     string `json:"ciphertext"`
+}
+
+type CertificateData struct {
+    SerialNo           string              `json:"serial_no"`
+    EffectiveTime      time.Time           `json:"effective_time"`
+    ExpireTime         time.Time           `json:"expire_time"`
+    EncryptCertificate *EncryptCertificate `json:"encrypt_certificate"`
+}
+
+type CertificatesResponse struct {
+    Data []*CertificateData `json:"data"`
+}
+
+// CertificateManager downloads platform certificates from GET /v3/certificates,
+// keeps them keyed by serial number and refreshes them before they expire
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wechatpay/wechatpay5_1.shtml
+type CertificateManager struct {
+    client   *Client
+    apiV3Key string
+
+    // Roots is used to verify the certificate chain, usually the Tenpay.com Root CA
+    Roots *x509.CertPool
+    // InsecureSkipChainVerify only checks the validity period of the certificates,
+    // the response signature is then the only thing vouching for them
+    InsecureSkipChainVerify bool
+    // RefreshInterval is the period between two downloads
+    RefreshInterval time.Duration
+
+    mu sync.RWMutex
+    // certs are keyed by upper case serial number
+    certs       map[string]*Certificate
+    lastAttempt time.Time
+}
+
+// NewCertificateManager creates a manager verifying the certificate chain with roots,
+// apiV3Key defaults to the APIv3Key of client
+func NewCertificateManager(client *Client, apiV3Key string, roots *x509.CertPool) (*CertificateManager, error) {
+    if roots == nil {
+        return nil, ErrNoRoots
+    }
+    m := newCertificateManager(client, apiV3Key)
+    m.Roots = roots
+    return m, nil
+}
+
+// NewInsecureCertificateManager creates a manager which does not verify the certificate chain
+func NewInsecureCertificateManager(client *Client, apiV3Key string) *CertificateManager {
+    m := newCertificateManager(client, apiV3Key)
+    m.InsecureSkipChainVerify = true
+    return m
+}
+
+func newCertificateManager(client *Client, apiV3Key string) *CertificateManager {
+    if apiV3Key == "" {
+        apiV3Key = client.APIv3Key
+    }
+    return &CertificateManager{
+        client:          client,
+        apiV3Key:        apiV3Key,
+        RefreshInterval: defaultRefreshInterval,
+        certs:           make(map[string]*Certificate),
+    }
+}
+
+// Refresh downloads the platform certificates and replaces the cached ones
+func (m *CertificateManager) Refresh(ctx context.Context) (err error) {
+    req, err := m.client.NewRequest(ctx, http.MethodGet, certificatesPath, nil)
+    if err != nil {
+        return
+    }
+    response, body, err := m.client.send(req)
+    if err != nil {
+        return
+    }
+
+    result := &CertificatesResponse{}
+    if err = json.Unmarshal(body, result); err != nil {
+        return
+    }
+
+    now := time.Now()
+    certs := make(map[string]*Certificate, len(result.Data))
+    for _, data := range result.Data {
+        var cert *Certificate
+        cert, err = m.decrypt(data, now)
+        if err != nil {
+            return
+        }
+        certs[strings.ToUpper(cert.SerialNo)] = cert
+    }
+    if len(certs) == 0 {
+        return ErrNoCertificate
+    }
+
+    // the response must be signed by one of the certificates it contains
+    cert, ok := certs[strings.ToUpper(response.Header.Get(headerSerial))]
+    if !ok {
+        return fmt.Errorf("wxpay: certificates response signed by unknown serial %q", response.Header.Get(headerSerial))
+    }
+    if err = verifySignature(cert.PublicKey(), response.Header, body); err != nil {
+        return
+    }
+
+    m.mu.Lock()
+    m.certs = certs
+    m.mu.Unlock()
+
+    return
+}
+
+func (m *CertificateManager) decrypt(data *CertificateData, now time.Time) (cert *Certificate, err error) {
+    if data.EncryptCertificate == nil {
+        return nil, fmt.Errorf("wxpay: certificate %s has no encrypted content", data.SerialNo)
+    }
+    ciphertext, err := base64.StdEncoding.DecodeString(data.EncryptCertificate.Ciphertext)
+    if err != nil {
+        return
+    }
+    plaintext, err := CertificateDecrypt(ciphertext, m.apiV3Key,
+        data.EncryptCertificate.Nonce, data.EncryptCertificate.AssociatedData)
+    if err != nil {
+        return nil, fmt.Errorf("wxpay: decrypt certificate %s: %v", data.SerialNo, err)
+    }
+
+    block, _ := pem.Decode([]byte(plaintext))
+    if block == nil {
+        return nil, fmt.Errorf("wxpay: certificate %s is not PEM encoded", data.SerialNo)
+    }
+    x509Cert, err := x509.ParseCertificate(block.Bytes)
+    if err != nil {
+        return
+    }
+    if _, ok := x509Cert.PublicKey.(*rsa.PublicKey); !ok {
+        return nil, fmt.Errorf("wxpay: certificate %s does not hold a RSA key", data.SerialNo)
+    }
+    if serial := CertificateSerialNo(x509Cert); !sameSerialNo(serial, data.SerialNo) {
+        return nil, fmt.Errorf("wxpay: certificate serial %s does not match %s", serial, data.SerialNo)
+    }
+
+    switch {
+    case m.Roots != nil:
+        opts := x509.VerifyOptions{
+            Roots:       m.Roots,
+            CurrentTime: now,
+            KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+        }
+        if _, err = x509Cert.Verify(opts); err != nil {
+            return nil, fmt.Errorf("wxpay: verify certificate %s: %v", data.SerialNo, err)
+        }
+    case !m.InsecureSkipChainVerify:
+        return nil, ErrNoRoots
+    case now.Before(x509Cert.NotBefore) || now.After(x509Cert.NotAfter):
+        return nil, fmt.Errorf("wxpay: certificate %s is not valid at %s", data.SerialNo, now.Format(time.RFC3339))
+    }
+
+    cert = &Certificate{
+        SerialNo:      data.SerialNo,
+        EffectiveTime: data.EffectiveTime,
+        ExpireTime:    data.ExpireTime,
+        Certificate:   x509Cert,
+    }
+    if cert.EffectiveTime.IsZero() {
+        cert.EffectiveTime = x509Cert.NotBefore
+    }
+    if cert.ExpireTime.IsZero() {
+        cert.ExpireTime = x509Cert.NotAfter
+    }
+    return
+}
+
+// Get returns the certificate with the serial number, whatever its case
+func (m *CertificateManager) Get(serialNo string) (cert *Certificate, ok bool) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    cert, ok = m.certs[strings.ToUpper(serialNo)]
+    if ok && time.Now().After(cert.ExpireTime) {
+        return nil, false
+    }
+    return
+}
+
+// Latest returns the valid certificate which expires last, it is the one to encrypt with
+func (m *CertificateManager) Latest() (cert *Certificate, err error) {
+    certs := m.Certificates()
+    if len(certs) == 0 {
+        return nil, ErrNoCertificate
+    }
+    return certs[len(certs)-1], nil
+}
+
+// Certificates returns the valid certificates sorted by expire time
+func (m *CertificateManager) Certificates() []*Certificate {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    now := time.Now()
+    certs := make([]*Certificate, 0, len(m.certs))
+    for _, cert := range m.certs {
+        if now.Before(cert.ExpireTime) {
+            certs = append(certs, cert)
+        }
+    }
+    sort.Slice(certs, func(i, j int) bool {
+        return certs[i].ExpireTime.Before(certs[j].ExpireTime)
+    })
+    return certs
+}
+
+// Start refreshes the certificates in background until ctx is done.
+// The first download happens synchronously so that its error is reported to the caller.
+func (m *CertificateManager) Start(ctx context.Context) (err error) {
+    if err = m.Refresh(ctx); err != nil {
+        return
+    }
+    go m.loop(ctx)
+    return
+}
+
+func (m *CertificateManager) loop(ctx context.Context) {
+    timer := time.NewTimer(m.nextRefresh())
+    defer timer.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-timer.C:
+        }
+        next := retryRefreshInterval
+        if err := m.Refresh(ctx); err != nil {
+            m.client.logger.Printf("wxpay: refresh platform certificates: %v", err)
+        } else {
+            next = m.nextRefresh()
+        }
+        timer.Reset(next)
+    }
+}
+
+func (m *CertificateManager) nextRefresh() time.Duration {
+    interval := m.RefreshInterval
+    if interval <= 0 {
+        interval = defaultRefreshInterval
+    }
+    for _, cert := range m.Certificates() {
+        // refresh ahead of expiry so that the successor is known in time
+        if d := time.Until(cert.ExpireTime) - defaultRefreshBeforeExpiry; d > 0 && d < interval {
+            interval = d
+        }
+    }
+    if interval < retryRefreshInterval {
+        interval = retryRefreshInterval
+    }
+    return interval
+}
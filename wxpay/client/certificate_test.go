@@ -0,0 +1,90 @@
+package client
+
+import (
+    "context"
+    "crypto/aes"
+    "crypto/cipher"
+    "encoding/base64"
+    "encoding/json"
+    "math/big"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+const testAPIv3Key = "0123456789abcdef0123456789abcdef"
+
+// certificatesServer serves the test certificate encrypted with testAPIv3Key
+func certificatesServer(t *testing.T, downloads *int32) *httptest.Server {
+    serial, _ := new(big.Int).SetString(testSerialNo, 16)
+    cert := newTestCertificate(t, newTestKey(t), serial, time.Now().Add(24*time.Hour))
+
+    block, err := aes.NewCipher([]byte(testAPIv3Key))
+    if err != nil {
+        t.Fatal(err)
+    }
+    gcm, err := cipher.NewGCM(block)
+    if err != nil {
+        t.Fatal(err)
+    }
+    nonce, ad := "0123456789ab", "certificate"
+    ciphertext := gcm.Seal(nil, []byte(nonce), encodeCertificate(cert), []byte(ad))
+    body, err := json.Marshal(&CertificatesResponse{Data: []*CertificateData{{
+        SerialNo: testSerialNo,
+        EncryptCertificate: &EncryptCertificate{
+            Algorithm:      "AEAD_AES_256_GCM",
+            Nonce:          nonce,
+            AssociatedData: ad,
+            Ciphertext:     base64.StdEncoding.EncodeToString(ciphertext),
+        },
+    }}})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        atomic.AddInt32(downloads, 1)
+        writeSigned(t, w, http.StatusOK, string(body))
+    }))
+}
+
+func TestCertificateManagerSerialCase(t *testing.T) {
+    var downloads int32
+    ts := certificatesServer(t, &downloads)
+    defer ts.Close()
+
+    c := newTestClient(t, ts.URL, WithAPIv3Key(testAPIv3Key))
+    m := NewInsecureCertificateManager(c, "")
+    if err := m.Refresh(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    c.Verifier = m
+
+    if _, ok := m.Get(strings.ToLower(testSerialNo)); !ok {
+        t.Fatal("certificate not found by lower case serial")
+    }
+
+    // a lower case Wechatpay-Serial is verified without downloading the certificates again
+    header := http.Header{}
+    header.Set(headerTimestamp, "1600000000")
+    header.Set(headerNonce, "nonce")
+    header.Set(headerSerial, strings.ToLower(testSerialNo))
+    signer, err := NewRSASignerFromKey(testSerialNo, newTestKey(t))
+    if err != nil {
+        t.Fatal(err)
+    }
+    signature, _, err := signer.Sign(context.Background(), []byte("1600000000\nnonce\n{}\n"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    header.Set(headerSignature, signature)
+    if err = c.verifySign(context.Background(), header, []byte("{}")); err != nil {
+        t.Fatal(err)
+    }
+    if n := atomic.LoadInt32(&downloads); n != 1 {
+        t.Fatalf("certificates downloaded %d times, want once", n)
+    }
+}
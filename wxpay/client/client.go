@@ -2,16 +2,10 @@ package client
 
 import (
     "bytes"
-    "crypto"
+    "context"
     "crypto/aes"
     "crypto/cipher"
-    "crypto/rand"
-    "crypto/rsa"
-    "crypto/sha256"
-    "crypto/x509"
-    "encoding/base64"
     "encoding/json"
-    "encoding/pem"
     "fmt"
     "io"
     "io/ioutil"
@@ -35,6 +29,7 @@ const (
     headerTimestamp = "Wechatpay-Timestamp"
     headerNonce     = "Wechatpay-Nonce"
     headerSignature = "Wechatpay-Signature"
+    headerSerial    = "Wechatpay-Serial"
 
     defaultAuthType = "WECHATPAY2-SHA256-RSA2048"
 
@@ -50,42 +45,84 @@ type Client struct {
     mu     sync.Mutex
     client *http.Client
 
-    BaseURL *url.URL
+    BaseURL   *url.URL
+    UserAgent string
 
     MchId      int64
     SerialNo   string
     PrivateKey string
     PublicKey  string
+    // APIv3Key decrypts platform certificates and notification resources
+    APIv3Key string
+
+    // Signer signs requests, see RSASigner and SignerFunc
+    Signer Signer
+    // Verifier verifies the signature of responses, see CertificateManager and CertificateVerifier
+    Verifier Verifier
+    // MaxClockSkew is the accepted difference between Wechatpay-Timestamp and now,
+    // DefaultMaxClockSkew when zero and unchecked when negative
+    MaxClockSkew time.Duration
+    // NonceStore rejects replayed Wechatpay-Nonce when set, see NewLRUNonceStore
+    NonceStore NonceStore
+    // RetryPolicy retries failed requests when set, see DefaultRetryPolicy
+    RetryPolicy *RetryPolicy
+    // Failover switches to the backup domain on connection errors when set, see WithFailover
+    Failover *Failover
+
+    logger Logger
+    // timeout is set by WithTimeout
+    timeout time.Duration
+
+    // initErr keeps the configuration error of New until the first request
+    initErr error
 }
 
-func New(mchId int64, serialNo, privateKey, publicKey string) *Client {
-    baseURL, _ := url.Parse(defaultBaseURL)
-
-    pay := &Client{
-        mu:         sync.Mutex{},
-        client:     &http.Client{},
-        BaseURL:    baseURL,
-        MchId:      mchId,
-        SerialNo:   serialNo,
-        PrivateKey: privateKey,
-        PublicKey:  publicKey,
+func New(mchId int64, serialNo, privateKey, publicKey string, opts ...Option) *Client {
+    pay := newClient(mchId)
+    pay.SerialNo = serialNo
+    if privateKey != "" {
+        opts = append([]Option{WithPrivateKey(serialNo, privateKey)}, opts...)
     }
+    if publicKey != "" {
+        opts = append([]Option{WithPublicKey(publicKey)}, opts...)
+    }
+    for _, opt := range opts {
+        if err := opt(pay); err != nil && pay.initErr == nil {
+            pay.initErr = err
+        }
+    }
+    pay.applyTimeout()
 
     return pay
 }
 
-func (pay *Client) NewRequest(method, rawurl string, body interface{}) (req *http.Request, err error) {
-    if !strings.HasSuffix(pay.BaseURL.Path, "/") {
-        return nil, fmt.Errorf("BaseURL must have a trailing slash, but %q does not", pay.BaseURL)
+func newClient(mchId int64) *Client {
+    baseURL, _ := url.Parse(defaultBaseURL)
+
+    return &Client{
+        mu:        sync.Mutex{},
+        client:    &http.Client{},
+        BaseURL:   baseURL,
+        UserAgent: userAgent,
+        MchId:     mchId,
+        logger:    stdLogger{},
     }
-    u, err := pay.BaseURL.Parse(rawurl)
+}
+
+// NewRequest creates a signed API request, ctx cancels the request when it is done
+func (pay *Client) NewRequest(ctx context.Context, method, rawurl string, body interface{}) (req *http.Request, err error) {
+    u, err := pay.resolve(rawurl)
     if err != nil {
         return
     }
 
     var buf io.ReadWriter
     var text []byte
+    var serialNo string
     if body != nil {
+        if body, serialNo, err = pay.encryptBody(body); err != nil {
+            return
+        }
         text, err = json.Marshal(body)
         buf = bytes.NewBuffer(text)
         if err != nil {
@@ -93,114 +130,108 @@ func (pay *Client) NewRequest(method, rawurl string, body interface{}) (req *htt
         }
     }
 
-    req, err = http.NewRequest(method, u.String(), buf)
-    if err != nil {
-        return
-    }
-
-    timestamp := time.Now().Unix()
-    nonce := randstr.Hex(32)
-    signature, err := pay.sign(req, timestamp, nonce, string(text))
+    req, err = http.NewRequestWithContext(ctx, method, u.String(), buf)
     if err != nil {
         return
     }
 
     req.Header.Set("Content-Type", defaultMediaType)
-    req.Header.Set("User-Agent", userAgent)
+    req.Header.Set("User-Agent", pay.UserAgent)
     req.Header.Set("Accept", defaultMediaType)
-    req.Header.Set("Authorization", pay.authorization(timestamp, nonce, signature))
+    if serialNo != "" {
+        req.Header.Set(headerSerial, serialNo)
+    }
+    err = pay.authorize(req, string(text))
 
     return
 }
 
-func (pay *Client) Do(req *http.Request, v interface{}) (err error) {
-    response, err := pay.client.Do(req)
+// resolve resolves rawurl against BaseURL
+func (pay *Client) resolve(rawurl string) (u *url.URL, err error) {
+    if pay.initErr != nil {
+        return nil, pay.initErr
+    }
+    if !strings.HasSuffix(pay.BaseURL.Path, "/") {
+        return nil, fmt.Errorf("BaseURL must have a trailing slash, but %q does not", pay.BaseURL)
+    }
+    return pay.BaseURL.Parse(rawurl)
+}
+
+// authorize signs the request with a fresh timestamp and nonce
+func (pay *Client) authorize(req *http.Request, body string) (err error) {
+    timestamp := time.Now().Unix()
+    nonce := randstr.Hex(32)
+    signature, serialNo, err := pay.sign(req.Context(), req, timestamp, nonce, body)
     if err != nil {
         return
     }
-    defer response.Body.Close()
-    body, err := ioutil.ReadAll(response.Body)
+    req.Header.Set("Authorization", pay.authorization(timestamp, nonce, signature, serialNo))
+    return
+}
+
+func (pay *Client) Do(req *http.Request, v interface{}) (err error) {
+    response, body, err := pay.send(req)
     if err != nil {
         return
     }
-    
-    // @TODO
-    _ = checkResponse(response)
+
     // verify signature
-    if err = pay.verify(response.Header, body); err != nil {
+    if err = pay.Verify(req.Context(), response.Header, body); err != nil {
         return
     }
 
-    if v != nil {
-        buf := bytes.NewReader(body)
-        if w, ok := v.(io.Writer); ok {
-            _, _ = io.Copy(w, buf)
-        } else {
-            err = json.NewDecoder(buf).Decode(v)
-            if err == io.EOF {
-                err = nil // ignore EOF errors caused by empty response body
-            }
-            if err != nil {
-                return
-            }
-        }
-    }
-
-    return
+    return decodeBody(body, v)
 }
 
-func (pay *Client) sign(req *http.Request, timestamp int64, nonce, body string) (signature string, err error) {
-    str := fmt.Sprintf(fmtSign, req.Method, req.URL.RequestURI(), timestamp, nonce, body)
-    hash := sha256.New()
-    hash.Write([]byte(str))
-    block, _ := pem.Decode([]byte(pay.PrivateKey))
-    key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+// roundTrip performs one attempt and checks the status code without verifying the signature
+func (pay *Client) roundTrip(req *http.Request) (response *http.Response, body []byte, err error) {
+    response, err = pay.client.Do(req)
     if err != nil {
+        // report the context error rather than the transport one
+        select {
+        case <-req.Context().Done():
+            err = req.Context().Err()
+        default:
+        }
         return
     }
-    sign, err := rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, hash.Sum(nil))
+    defer response.Body.Close()
+    body, err = ioutil.ReadAll(response.Body)
     if err != nil {
         return
     }
-    signature = base64.StdEncoding.EncodeToString(sign)
 
+    err = checkResponse(response, body)
     return
 }
 
-func (pay *Client) verify(header http.Header, body []byte) (err error) {
-    timestamp := header.Get(headerTimestamp)
-    nonce := header.Get(headerNonce)
-    signature := header.Get(headerSignature)
-
-    signStr := fmt.Sprintf("%s\n%s\n%s\n", timestamp, nonce, string(body))
-    decodeString, err := base64.StdEncoding.DecodeString(signature)
-    if err != nil {
+func decodeBody(body []byte, v interface{}) (err error) {
+    if v == nil {
         return
     }
-
-    hash := sha256.New()
-    hash.Write([]byte(signStr))
-
-    block, _ := pem.Decode([]byte(pay.PublicKey))
-    key, err := x509.ParsePKIXPublicKey(block.Bytes)
-    if err != nil {
+    buf := bytes.NewReader(body)
+    if w, ok := v.(io.Writer); ok {
+        _, err = io.Copy(w, buf)
         return
     }
-
-    return rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, hash.Sum(nil), decodeString)
-}
-
-func (pay *Client) authorization(timestamp int64, nonce, signature string) string {
-    return fmt.Sprintf(fmtAuth, defaultAuthType, pay.MchId, nonce, signature, timestamp, pay.SerialNo)
+    err = json.NewDecoder(buf).Decode(v)
+    if err == io.EOF {
+        err = nil // ignore EOF errors caused by empty response body
+    }
+    return
 }
 
-func checkResponse(resp *http.Response) error {
-    return nil
+func (pay *Client) sign(ctx context.Context, req *http.Request, timestamp int64, nonce, body string) (
+    signature, serialNo string, err error) {
+    if pay.Signer == nil {
+        return "", "", ErrNoSigner
+    }
+    str := fmt.Sprintf(fmtSign, req.Method, req.URL.RequestURI(), timestamp, nonce, body)
+    return pay.Signer.Sign(ctx, []byte(str))
 }
 
-type ErrorMessage struct {
-    Code    string `json:"code"`
-    Message string `json:"message"`
+func (pay *Client) authorization(timestamp int64, nonce, signature, serialNo string) string {
+    return fmt.Sprintf(fmtAuth, defaultAuthType, pay.MchId, nonce, signature, timestamp, serialNo)
 }
 
 func AddOptions(s string, opt interface{}) (string, error) {
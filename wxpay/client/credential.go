@@ -0,0 +1,206 @@
+package client
+
+import (
+    "crypto/rsa"
+    "crypto/x509"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "os"
+    "strconv"
+    "strings"
+
+    "golang.org/x/crypto/pkcs12"
+)
+
+// 环境变量
+const (
+    EnvMchId          = "WXPAY_MCHID"
+    EnvSerialNo       = "WXPAY_SERIAL_NO"
+    EnvPrivateKey     = "WXPAY_PRIVATE_KEY"
+    EnvPrivateKeyFile = "WXPAY_PRIVATE_KEY_FILE"
+    EnvCertFile       = "WXPAY_CERT_FILE"
+    EnvP12File        = "WXPAY_P12_FILE"
+    EnvP12Password    = "WXPAY_P12_PASSWORD"
+    EnvPublicKey      = "WXPAY_PUBLIC_KEY"
+)
+
+// Credential is the merchant API private key and the certificate it belongs to
+type Credential struct {
+    MchId       int64
+    SerialNo    string
+    PrivateKey  *rsa.PrivateKey
+    Certificate *x509.Certificate
+}
+
+// Validate checks the serial number and the private key against the certificate
+func (cred *Credential) Validate() error {
+    if cred.PrivateKey == nil {
+        return errors.New("wxpay: credential has no private key")
+    }
+    if cred.SerialNo == "" {
+        return errors.New("wxpay: credential has no serial number")
+    }
+    if cred.Certificate == nil {
+        return nil
+    }
+    if serial := CertificateSerialNo(cred.Certificate); !sameSerialNo(serial, cred.SerialNo) {
+        return fmt.Errorf("wxpay: serial number %s does not match certificate serial %s", cred.SerialNo, serial)
+    }
+    pub, ok := cred.Certificate.PublicKey.(*rsa.PublicKey)
+    if !ok || pub.N.Cmp(cred.PrivateKey.N) != 0 || pub.E != cred.PrivateKey.E {
+        return fmt.Errorf("wxpay: private key does not belong to certificate %s", cred.SerialNo)
+    }
+    return nil
+}
+
+// Signer creates the RSASigner of the credential
+func (cred *Credential) Signer() (*RSASigner, error) {
+    if err := cred.Validate(); err != nil {
+        return nil, err
+    }
+    return NewRSASignerFromKey(cred.SerialNo, cred.PrivateKey)
+}
+
+// LoadCredentialFiles loads apiclient_key.pem and apiclient_cert.pem,
+// the serial number is taken from the certificate
+func LoadCredentialFiles(mchId int64, keyFile, certFile string) (cred *Credential, err error) {
+    key, err := LoadPrivateKeyFile(keyFile)
+    if err != nil {
+        return
+    }
+    cert, err := LoadCertificateFile(certFile)
+    if err != nil {
+        return
+    }
+    cred = &Credential{
+        MchId:       mchId,
+        SerialNo:    CertificateSerialNo(cert),
+        PrivateKey:  key,
+        Certificate: cert,
+    }
+    if err = cred.Validate(); err != nil {
+        return nil, err
+    }
+    return
+}
+
+// LoadPKCS12File loads apiclient_cert.p12, the password defaults to the merchant id
+func LoadPKCS12File(mchId int64, p12File, password string) (cred *Credential, err error) {
+    data, err := ioutil.ReadFile(p12File)
+    if err != nil {
+        return nil, fmt.Errorf("wxpay: read %s: %v", p12File, err)
+    }
+    if password == "" {
+        password = strconv.FormatInt(mchId, 10)
+    }
+    k, cert, err := pkcs12.Decode(data, password)
+    if err != nil {
+        return nil, fmt.Errorf("wxpay: decode %s: %v", p12File, err)
+    }
+    key, ok := k.(*rsa.PrivateKey)
+    if !ok {
+        return nil, fmt.Errorf("wxpay: %s does not hold a RSA key", p12File)
+    }
+    cred = &Credential{
+        MchId:       mchId,
+        SerialNo:    CertificateSerialNo(cert),
+        PrivateKey:  key,
+        Certificate: cert,
+    }
+    if err = cred.Validate(); err != nil {
+        return nil, err
+    }
+    return
+}
+
+// LoadCredentialFromEnv reads the credential from WXPAY_* environment variables:
+// WXPAY_MCHID and either WXPAY_P12_FILE (with optional WXPAY_P12_PASSWORD),
+// or WXPAY_PRIVATE_KEY / WXPAY_PRIVATE_KEY_FILE together with WXPAY_CERT_FILE or WXPAY_SERIAL_NO
+func LoadCredentialFromEnv() (cred *Credential, err error) {
+    mchId, err := strconv.ParseInt(os.Getenv(EnvMchId), 10, 64)
+    if err != nil {
+        return nil, fmt.Errorf("wxpay: invalid %s %q", EnvMchId, os.Getenv(EnvMchId))
+    }
+
+    if p12File := os.Getenv(EnvP12File); p12File != "" {
+        return LoadPKCS12File(mchId, p12File, os.Getenv(EnvP12Password))
+    }
+
+    cred = &Credential{MchId: mchId, SerialNo: os.Getenv(EnvSerialNo)}
+    switch {
+    case os.Getenv(EnvPrivateKey) != "":
+        cred.PrivateKey, err = ParsePrivateKey(os.Getenv(EnvPrivateKey))
+    case os.Getenv(EnvPrivateKeyFile) != "":
+        cred.PrivateKey, err = LoadPrivateKeyFile(os.Getenv(EnvPrivateKeyFile))
+    default:
+        err = fmt.Errorf("wxpay: one of %s, %s or %s must be set", EnvP12File, EnvPrivateKey, EnvPrivateKeyFile)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if certFile := os.Getenv(EnvCertFile); certFile != "" {
+        if cred.Certificate, err = LoadCertificateFile(certFile); err != nil {
+            return nil, err
+        }
+        if cred.SerialNo == "" {
+            cred.SerialNo = CertificateSerialNo(cred.Certificate)
+        }
+    }
+    if err = cred.Validate(); err != nil {
+        return nil, err
+    }
+    return
+}
+
+// NewFromCredential creates a client signing with the credential,
+// publicKey is the platform certificate or WeChat Pay public key in PEM
+func NewFromCredential(cred *Credential, publicKey string, opts ...Option) (pay *Client, err error) {
+    // the options of the caller come last so that they win
+    defaults := []Option{WithCredential(cred)}
+    if publicKey != "" {
+        defaults = append(defaults, WithPublicKey(publicKey))
+    }
+    return NewClient(cred.MchId, append(defaults, opts...)...)
+}
+
+// NewFromEnv creates a client from LoadCredentialFromEnv and WXPAY_PUBLIC_KEY
+func NewFromEnv(opts ...Option) (pay *Client, err error) {
+    cred, err := LoadCredentialFromEnv()
+    if err != nil {
+        return
+    }
+    return NewFromCredential(cred, os.Getenv(EnvPublicKey), opts...)
+}
+
+func LoadPrivateKeyFile(path string) (key *rsa.PrivateKey, err error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("wxpay: read %s: %v", path, err)
+    }
+    return ParsePrivateKey(string(data))
+}
+
+func LoadCertificateFile(path string) (cert *x509.Certificate, err error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("wxpay: read %s: %v", path, err)
+    }
+    block, _ := pem.Decode(data)
+    if block == nil || block.Type != "CERTIFICATE" {
+        return nil, fmt.Errorf("wxpay: %s is not a PEM encoded certificate", path)
+    }
+    return x509.ParseCertificate(block.Bytes)
+}
+
+// CertificateSerialNo formats the serial number the way WeChat Pay displays it,
+// 40 hex digits with the leading zeros the integer value drops
+func CertificateSerialNo(cert *x509.Certificate) string {
+    return fmt.Sprintf("%040X", cert.SerialNumber)
+}
+
+func sameSerialNo(a, b string) bool {
+    return strings.EqualFold(a, b)
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+    "context"
+    "crypto/x509"
+    "errors"
+    "io/ioutil"
+    "math/big"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// serials of 20 bytes whose first digits are zero
+const (
+    testZeroNibbleSerial = "0A57F09EFDC096DE15EBE81A47057A7232F1B8E1"
+    testZeroByteSerial   = "0057F09EFDC096DE15EBE81A47057A7232F1B8E1"
+)
+
+func newSerialCertificate(t *testing.T, serial string) *x509.Certificate {
+    n, ok := new(big.Int).SetString(serial, 16)
+    if !ok {
+        t.Fatalf("invalid serial %s", serial)
+    }
+    return newTestCertificate(t, newTestKey(t), n, time.Now().Add(time.Hour))
+}
+
+func TestCertificateSerialNo(t *testing.T) {
+    for _, serial := range []string{testSerialNo, testZeroNibbleSerial, testZeroByteSerial} {
+        if got := CertificateSerialNo(newSerialCertificate(t, serial)); got != serial {
+            t.Errorf("serial %s, want %s", got, serial)
+        }
+    }
+}
+
+func TestCertificateSerialNoLeadingZero(t *testing.T) {
+    key := newTestKey(t)
+    cert := newSerialCertificate(t, testZeroByteSerial)
+
+    dir, err := ioutil.TempDir("", "wxpay")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    keyFile := filepath.Join(dir, "apiclient_key.pem")
+    certFile := filepath.Join(dir, "apiclient_cert.pem")
+    if err = ioutil.WriteFile(keyFile, encodePrivateKey(key), 0600); err != nil {
+        t.Fatal(err)
+    }
+    if err = ioutil.WriteFile(certFile, encodeCertificate(cert), 0600); err != nil {
+        t.Fatal(err)
+    }
+
+    cred, err := LoadCredentialFiles(1900000001, keyFile, certFile)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if cred.SerialNo != testZeroByteSerial {
+        t.Errorf("credential serial %q, want %s", cred.SerialNo, testZeroByteSerial)
+    }
+    signer, err := cred.Signer()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, serial, _ := signer.Sign(context.Background(), []byte("message")); serial != testZeroByteSerial {
+        t.Errorf("signer serial %q, want %s", serial, testZeroByteSerial)
+    }
+
+    // a serial without the leading zero names another certificate
+    cred.SerialNo = testZeroByteSerial[2:]
+    if err = cred.Validate(); err == nil {
+        t.Error("serial without the leading zero byte validated")
+    }
+}
+
+func TestCertificateVerifierLeadingZero(t *testing.T) {
+    key := newTestKey(t)
+    v := NewCertificateVerifier(newSerialCertificate(t, testZeroByteSerial))
+
+    signer, err := NewRSASignerFromKey(testZeroByteSerial, key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    message := []byte("1600000000\nnonce\n{}\n")
+    signature, _, err := signer.Sign(context.Background(), message)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err = v.Verify(testZeroByteSerial, message, signature); err != nil {
+        t.Errorf("verify by Wechatpay-Serial %s: %v", testZeroByteSerial, err)
+    }
+    if err = v.Verify(testZeroByteSerial[2:], message, signature); !errors.Is(err, ErrUnknownSerial) {
+        t.Errorf("verify without the leading zero byte: %v, want ErrUnknownSerial", err)
+    }
+}
+
+func TestNewFromCredentialCallerVerifierWins(t *testing.T) {
+    key := newTestKey(t)
+    cred := &Credential{MchId: 1900000001, SerialNo: testSerialNo, PrivateKey: key}
+    publicKey := string(encodeCertificate(newSerialCertificate(t, testSerialNo)))
+
+    pay, err := NewFromCredential(cred, publicKey)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := pay.Verifier.(*CertificateVerifier); !ok {
+        t.Fatalf("verifier %T, want the one of the public key", pay.Verifier)
+    }
+
+    verifier := NewCertificateVerifier()
+    pay, err = NewFromCredential(cred, publicKey, WithVerifier(verifier))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if pay.Verifier != verifier {
+        t.Fatalf("verifier %T, want the one given by the caller", pay.Verifier)
+    }
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+    "context"
+    "crypto/sha1"
+    "crypto/sha256"
+    "encoding/hex"
+    "fmt"
+    "hash"
+    "net/http"
+    "strings"
+)
+
+// Download fetches a bill file from the url returned by the bill APIs.
+// The file is not signed by WeChat Pay, hashType and hashValue are checked instead.
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/pay/bill/chapter3_3.shtml
+func (pay *Client) Download(ctx context.Context, rawurl, hashType, hashValue string) (content []byte, err error) {
+    req, err := pay.NewRequest(ctx, http.MethodGet, rawurl, nil)
+    if err != nil {
+        return
+    }
+    _, content, err = pay.send(req)
+    if err != nil {
+        return
+    }
+    if err = CheckHash(content, hashType, hashValue); err != nil {
+        return nil, err
+    }
+    return
+}
+
+// CheckHash compares the hex digest of content with hashValue, hashType is SHA1 or SHA256
+func CheckHash(content []byte, hashType, hashValue string) error {
+    var h hash.Hash
+    switch strings.ToUpper(hashType) {
+    case "SHA1":
+        h = sha1.New()
+    case "SHA256":
+        h = sha256.New()
+    default:
+        return fmt.Errorf("wxpay: unsupported hash type %q", hashType)
+    }
+    h.Write(content)
+    if sum := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(sum, hashValue) {
+        return fmt.Errorf("wxpay: %s of file is %s, expect %s", hashType, sum, hashValue)
+    }
+    return nil
+}
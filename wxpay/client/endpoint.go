@@ -0,0 +1,207 @@
+package client
+
+import (
+    "errors"
+    "fmt"
+    "net"
+    "net/http"
+    "net/url"
+    "strings"
+    "sync"
+    "time"
+)
+
+// 备用域名
+// https://pay.weixin.qq.com/wiki/doc/apiv3/Practices/chapter1_1_4.shtml
+const backupBaseURL = "https://api2.mch.weixin.qq.com/v3/"
+
+const (
+    defaultFailureThreshold = 3
+    defaultCooldown         = time.Minute
+)
+
+// Failover sends requests to the first healthy endpoint. An endpoint failing with
+// connection errors FailureThreshold times in a row is skipped until Cooldown has passed,
+// after which it is tried again, so traffic returns to the primary once it recovers.
+type Failover struct {
+    FailureThreshold int
+    Cooldown         time.Duration
+
+    endpoints []*endpoint
+}
+
+type endpoint struct {
+    mu        sync.Mutex
+    baseURL   *url.URL
+    failures  int
+    openUntil time.Time
+}
+
+// NewFailover creates a failover over the endpoints in order of preference,
+// by default api.mch.weixin.qq.com and then api2.mch.weixin.qq.com
+func NewFailover(endpoints ...string) (failover *Failover, err error) {
+    if len(endpoints) == 0 {
+        endpoints = []string{defaultBaseURL, backupBaseURL}
+    }
+    failover = &Failover{
+        FailureThreshold: defaultFailureThreshold,
+        Cooldown:         defaultCooldown,
+    }
+    for _, rawurl := range endpoints {
+        if !strings.HasSuffix(rawurl, "/") {
+            rawurl += "/"
+        }
+        u, err := url.Parse(rawurl)
+        if err != nil {
+            return nil, fmt.Errorf("wxpay: invalid endpoint %q: %v", rawurl, err)
+        }
+        failover.endpoints = append(failover.endpoints, &endpoint{baseURL: u})
+    }
+    return
+}
+
+// WithFailover enables failing over to the backup domain, or to the given endpoints.
+// The first endpoint becomes the BaseURL.
+func WithFailover(endpoints ...string) Option {
+    return func(pay *Client) (err error) {
+        failover, err := NewFailover(endpoints...)
+        if err != nil {
+            return
+        }
+        pay.Failover = failover
+        pay.BaseURL = failover.endpoints[0].baseURL
+        return
+    }
+}
+
+// candidates returns the endpoints to try, healthy ones first in order of preference
+func (f *Failover) candidates() []*endpoint {
+    now := time.Now()
+    healthy := make([]*endpoint, 0, len(f.endpoints))
+    var broken []*endpoint
+    for _, e := range f.endpoints {
+        e.mu.Lock()
+        open := now.Before(e.openUntil)
+        e.mu.Unlock()
+        if open {
+            broken = append(broken, e)
+        } else {
+            healthy = append(healthy, e)
+        }
+    }
+    // when every endpoint is broken they are still worth a try
+    return append(healthy, broken...)
+}
+
+func (f *Failover) success(e *endpoint) {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    e.failures = 0
+    e.openUntil = time.Time{}
+}
+
+func (f *Failover) failure(e *endpoint) {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    e.failures++
+    threshold := f.FailureThreshold
+    if threshold <= 0 {
+        threshold = defaultFailureThreshold
+    }
+    if e.failures >= threshold {
+        cooldown := f.Cooldown
+        if cooldown <= 0 {
+            cooldown = defaultCooldown
+        }
+        e.openUntil = time.Now().Add(cooldown)
+    }
+}
+
+// attempt sends the request once per endpoint until one of them answers
+func (pay *Client) attempt(req *http.Request) (response *http.Response, body []byte, err error) {
+    if pay.Failover == nil {
+        return pay.roundTrip(req)
+    }
+
+    candidates := pay.Failover.candidates()
+    for i, e := range candidates {
+        var r *http.Request
+        if r, err = pay.rebase(req, e.baseURL); err != nil {
+            return
+        }
+        response, body, err = pay.roundTrip(r)
+        if req.Context().Err() != nil {
+            return
+        }
+        if !isConnectionError(err) {
+            pay.Failover.success(e)
+            return
+        }
+        pay.Failover.failure(e)
+
+        // a request which may have reached the server is only sent again when idempotent
+        if i+1 < len(candidates) && (isDialError(err) || idempotent(req, pay.idempotencyKeys())) {
+            pay.logger.Printf("wxpay: %s unavailable: %v, fail over to %s", e.baseURL.Host, err, candidates[i+1].baseURL.Host)
+            continue
+        }
+        return
+    }
+    return
+}
+
+// rebase points the request at another endpoint, re-signing it when the path changes
+func (pay *Client) rebase(req *http.Request, baseURL *url.URL) (r *http.Request, err error) {
+    if !strings.HasPrefix(req.URL.Path, pay.BaseURL.Path) {
+        return req, nil
+    }
+    u := *baseURL
+    u.Path = baseURL.Path + strings.TrimPrefix(req.URL.Path, pay.BaseURL.Path)
+    u.RawPath = ""
+    u.RawQuery = req.URL.RawQuery
+    if u.String() == req.URL.String() {
+        return req, nil
+    }
+
+    r = req.Clone(req.Context())
+    r.URL = &u
+    r.Host = u.Host
+    text, err := requestBody(req)
+    if err != nil {
+        return
+    }
+    if req.GetBody != nil {
+        if r.Body, err = req.GetBody(); err != nil {
+            return
+        }
+    }
+    if u.Path != req.URL.Path {
+        err = pay.authorize(r, signedBody(req, text))
+    }
+    return
+}
+
+func (pay *Client) idempotencyKeys() []string {
+    if pay.RetryPolicy != nil {
+        return pay.RetryPolicy.IdempotencyKeys
+    }
+    return DefaultRetryPolicy().IdempotencyKeys
+}
+
+// isConnectionError reports network errors and timeouts, not API errors
+func isConnectionError(err error) bool {
+    if err == nil {
+        return false
+    }
+    var apiErr *APIError
+    return !errors.As(err, &apiErr)
+}
+
+// isDialError reports errors raised before the request was written
+func isDialError(err error) bool {
+    var opErr *net.OpError
+    if errors.As(err, &opErr) {
+        return opErr.Op == "dial"
+    }
+    var dnsErr *net.DNSError
+    return errors.As(err, &dnsErr)
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+    "context"
+    "net"
+    "net/http"
+    "net/http/httptest"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// countingServer answers with a signed empty object and counts the requests
+type countingServer struct {
+    t    *testing.T
+    hits int32
+    // down closes connections without answering while set
+    down int32
+}
+
+func (s *countingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    atomic.AddInt32(&s.hits, 1)
+    if atomic.LoadInt32(&s.down) == 1 {
+        conn, _, err := w.(http.Hijacker).Hijack()
+        if err == nil {
+            conn.Close()
+        }
+        return
+    }
+    writeSigned(s.t, w, http.StatusOK, `{}`)
+}
+
+func (s *countingServer) count() int {
+    return int(atomic.LoadInt32(&s.hits))
+}
+
+// closedURL returns the url of a port nobody listens on
+func closedURL(t *testing.T) string {
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    addr := l.Addr().String()
+    l.Close()
+    return "http://" + addr + "/v3/"
+}
+
+func TestFailoverOnDialError(t *testing.T) {
+    backup := &countingServer{t: t}
+    ts := httptest.NewServer(backup)
+    defer ts.Close()
+    c := newTestClient(t, ts.URL, WithFailover(closedURL(t), ts.URL+"/v3/"))
+
+    // a write which never reached the primary is safe to send to the backup
+    req, err := c.NewRequest(context.Background(), http.MethodPost, "marketing/favor/users/o1/coupons",
+        map[string]string{"stock_id": "1"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err = c.Do(req, nil); err != nil {
+        t.Fatalf("fail over to backup: %v", err)
+    }
+    if backup.count() != 1 {
+        t.Errorf("backup received %d requests, want 1", backup.count())
+    }
+}
+
+func TestNoFailoverOfWriteAfterTimeout(t *testing.T) {
+    release := make(chan struct{})
+    primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        <-release
+    }))
+    defer primary.Close()
+    defer close(release)
+    backup := &countingServer{t: t}
+    ts := httptest.NewServer(backup)
+    defer ts.Close()
+    c := newTestClient(t, ts.URL, WithFailover(primary.URL+"/v3/", ts.URL+"/v3/"), WithTimeout(100*time.Millisecond))
+
+    // the primary may have issued the coupon, sending it again could issue a second one
+    req, err := c.NewRequest(context.Background(), http.MethodPost, "marketing/favor/users/o1/coupons",
+        map[string]string{"stock_id": "1"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err = c.Do(req, nil); err == nil {
+        t.Fatal("timed out write succeeded")
+    }
+    if backup.count() != 0 {
+        t.Errorf("backup received %d requests, want 0", backup.count())
+    }
+}
+
+func TestFailoverCircuitBreakerRecovers(t *testing.T) {
+    primary := &countingServer{t: t, down: 1}
+    ps := httptest.NewServer(primary)
+    defer ps.Close()
+    backup := &countingServer{t: t}
+    bs := httptest.NewServer(backup)
+    defer bs.Close()
+    c := newTestClient(t, ps.URL, WithFailover(ps.URL+"/v3/", bs.URL+"/v3/"))
+    c.Failover.FailureThreshold = 1
+    c.Failover.Cooldown = 100 * time.Millisecond
+
+    get := func() {
+        t.Helper()
+        req, err := c.NewRequest(context.Background(), http.MethodGet, "marketing/favor/stocks/1", nil)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if err = c.Do(req, nil); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    get()
+    if primary.count() != 1 || backup.count() != 1 {
+        t.Fatalf("primary %d, backup %d requests, want 1 and 1", primary.count(), backup.count())
+    }
+
+    // the open circuit skips the primary
+    get()
+    if primary.count() != 1 || backup.count() != 2 {
+        t.Fatalf("primary %d, backup %d requests while open, want 1 and 2", primary.count(), backup.count())
+    }
+
+    // after the cooldown the recovered primary takes the traffic back
+    atomic.StoreInt32(&primary.down, 0)
+    time.Sleep(150 * time.Millisecond)
+    get()
+    get()
+    if primary.count() != 3 || backup.count() != 2 {
+        t.Errorf("primary %d, backup %d requests after recovery, want 3 and 2", primary.count(), backup.count())
+    }
+}
+
+func TestTimeoutWithHTTPClient(t *testing.T) {
+    httpClient := &http.Client{}
+    for _, opts := range [][]Option{
+        {WithTimeout(time.Second), WithHTTPClient(httpClient)},
+        {WithHTTPClient(httpClient), WithTimeout(time.Second)},
+    } {
+        c, err := NewClient(1900000001, opts...)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if c.client.Timeout != time.Second {
+            t.Errorf("timeout %s, want 1s whatever the order", c.client.Timeout)
+        }
+        if httpClient.Timeout != 0 {
+            t.Fatal("the http client of the caller is modified")
+        }
+    }
+    if c := New(1900000001, "", "", "", WithTimeout(time.Second), WithHTTPClient(httpClient)); c.client.Timeout != time.Second {
+        t.Errorf("New: timeout %s, want 1s", c.client.Timeout)
+    }
+}
@@ -0,0 +1,131 @@
+package client
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "time"
+)
+
+const headerRequestID = "Request-ID"
+
+// 常见错误码
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wechatpay/wechatpay2_0.shtml
+const (
+    CodeParamError          = "PARAM_ERROR"
+    CodeInvalidRequest      = "INVALID_REQUEST"
+    CodeSignError           = "SIGN_ERROR"
+    CodeNoAuth              = "NO_AUTH"
+    CodeNotFound            = "NOT_FOUND"
+    CodeResourceNotExists   = "RESOURCE_NOT_EXISTS"
+    CodeFrequencyLimited    = "FREQUENCY_LIMITED"
+    CodeSystemError         = "SYSTEM_ERROR"
+    CodeNotEnough           = "NOT_ENOUGH"
+    CodeUserAccountAbnormal = "USER_ACCOUNT_ABNORMAL"
+    // CodeRuleLimit 用户已达到领取上限
+    CodeRuleLimit = "RULE_LIMIT"
+)
+
+type ErrorMessage struct {
+    Code    string `json:"code"`
+    Message string `json:"message"`
+}
+
+// ErrorDetail describes which part of the request was rejected
+type ErrorDetail struct {
+    Field    string      `json:"field"`
+    Value    interface{} `json:"value"`
+    Issue    string      `json:"issue"`
+    Location string      `json:"location"`
+}
+
+// APIError is returned by Client.Do for every non-2xx response
+type APIError struct {
+    ErrorMessage
+    Detail     *ErrorDetail `json:"detail,omitempty"`
+    StatusCode int          `json:"-"`
+    RequestID  string       `json:"-"`
+
+    retryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+    msg := fmt.Sprintf("wxpay: %d %s: %s", e.StatusCode, e.Code, e.Message)
+    if e.Detail != nil && e.Detail.Field != "" {
+        msg += fmt.Sprintf(" (%s %s: %s)", e.Detail.Location, e.Detail.Field, e.Detail.Issue)
+    }
+    if e.RequestID != "" {
+        msg += fmt.Sprintf(" [request id %s]", e.RequestID)
+    }
+    return msg
+}
+
+func checkResponse(resp *http.Response, body []byte) error {
+    if c := resp.StatusCode; 200 <= c && c <= 299 {
+        return nil
+    }
+    apiErr := &APIError{
+        StatusCode: resp.StatusCode,
+        RequestID:  resp.Header.Get(headerRequestID),
+        retryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+    }
+    if len(body) > 0 {
+        if err := json.Unmarshal(body, apiErr); err != nil {
+            apiErr.Message = string(body)
+        }
+    }
+    if apiErr.Message == "" {
+        apiErr.Message = http.StatusText(resp.StatusCode)
+    }
+    return apiErr
+}
+
+// AsAPIError reports whether err is an *APIError and returns it
+func AsAPIError(err error) (*APIError, bool) {
+    var apiErr *APIError
+    if errors.As(err, &apiErr) {
+        return apiErr, true
+    }
+    return nil, false
+}
+
+// HasCode reports whether err is an *APIError with the given code
+func HasCode(err error, code string) bool {
+    apiErr, ok := AsAPIError(err)
+    return ok && apiErr.Code == code
+}
+
+// IsNotFound reports whether the requested resource does not exist
+func IsNotFound(err error) bool {
+    apiErr, ok := AsAPIError(err)
+    if !ok {
+        return false
+    }
+    return apiErr.StatusCode == http.StatusNotFound ||
+        apiErr.Code == CodeNotFound || apiErr.Code == CodeResourceNotExists
+}
+
+// IsSystemError reports whether WeChat Pay failed internally, the request may be retried
+func IsSystemError(err error) bool {
+    apiErr, ok := AsAPIError(err)
+    if !ok {
+        return false
+    }
+    return apiErr.Code == CodeSystemError ||
+        (apiErr.Code == "" && apiErr.StatusCode >= http.StatusInternalServerError)
+}
+
+// IsFrequencyLimited reports whether the request was rejected by rate limiting
+func IsFrequencyLimited(err error) bool {
+    apiErr, ok := AsAPIError(err)
+    if !ok {
+        return false
+    }
+    return apiErr.Code == CodeFrequencyLimited || apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// IsNotEnough reports whether the stock budget or balance is exhausted
+func IsNotEnough(err error) bool {
+    return HasCode(err, CodeNotEnough)
+}
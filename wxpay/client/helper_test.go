@@ -0,0 +1,143 @@
+package client
+
+import (
+    "context"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "fmt"
+    "math/big"
+    "net/http"
+    "regexp"
+    "strconv"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+// testSerialNo names the test key, both as merchant and as platform certificate
+const testSerialNo = "5157F09EFDC096DE15EBE81A47057A7232F1B8E1"
+
+var (
+    testKeyOnce sync.Once
+    testKey     *rsa.PrivateKey
+)
+
+// newTestKey returns a 2048 bit key shared by the tests, generating it takes a while
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+    testKeyOnce.Do(func() {
+        key, err := rsa.GenerateKey(rand.Reader, 2048)
+        if err != nil {
+            t.Fatal(err)
+        }
+        testKey = key
+    })
+    return testKey
+}
+
+// newTestCertificate creates a self-signed certificate of key valid until notAfter
+func newTestCertificate(t *testing.T, key *rsa.PrivateKey, serial *big.Int, notAfter time.Time) *x509.Certificate {
+    template := &x509.Certificate{
+        SerialNumber: serial,
+        Subject:      pkix.Name{CommonName: "wxpay test"},
+        NotBefore:    time.Now().Add(-time.Hour),
+        NotAfter:     notAfter,
+    }
+    der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    cert, err := x509.ParseCertificate(der)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return cert
+}
+
+func encodeCertificate(cert *x509.Certificate) []byte {
+    return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+func encodePrivateKey(key *rsa.PrivateKey) []byte {
+    return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+type testLogger struct {
+    t *testing.T
+}
+
+func (l testLogger) Printf(format string, v ...interface{}) {
+    l.t.Logf(format, v...)
+}
+
+// newTestClient creates a client for baseURL which signs with the test key and
+// verifies responses signed by writeSigned
+func newTestClient(t *testing.T, baseURL string, opts ...Option) *Client {
+    key := newTestKey(t)
+    signer, err := NewRSASignerFromKey(testSerialNo, key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    verifier := NewCertificateVerifier()
+    verifier.AddPublicKey(testSerialNo, &key.PublicKey)
+    opts = append([]Option{
+        WithBaseURL(baseURL),
+        WithSigner(signer),
+        WithVerifier(verifier),
+        WithLogger(testLogger{t}),
+    }, opts...)
+    c, err := NewClient(1900000001, opts...)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return c
+}
+
+var testNonce int64
+
+// writeSigned writes a response signed with the test key
+func writeSigned(t *testing.T, w http.ResponseWriter, status int, body string) {
+    timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+    nonce := fmt.Sprintf("nonce%d", atomic.AddInt64(&testNonce, 1))
+    signer, err := NewRSASignerFromKey(testSerialNo, newTestKey(t))
+    if err != nil {
+        t.Fatal(err)
+    }
+    signature, _, err := signer.Sign(context.Background(), []byte(timestamp+"\n"+nonce+"\n"+body+"\n"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    w.Header().Set(headerTimestamp, timestamp)
+    w.Header().Set(headerNonce, nonce)
+    w.Header().Set(headerSignature, signature)
+    w.Header().Set(headerSerial, testSerialNo)
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    w.Write([]byte(body))
+}
+
+var authPattern = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// verifyRequest checks the Authorization header of a request and returns its nonce
+func verifyRequest(t *testing.T, r *http.Request, body []byte) (nonce string) {
+    fields := map[string]string{}
+    for _, m := range authPattern.FindAllStringSubmatch(r.Header.Get("Authorization"), -1) {
+        fields[m[1]] = m[2]
+    }
+    message := fmt.Sprintf(fmtSign, r.Method, r.URL.RequestURI(), mustAtoi(t, fields["timestamp"]), fields["nonce_str"], body)
+    if err := verifyMessage(&newTestKey(t).PublicKey, []byte(message), fields["signature"]); err != nil {
+        t.Errorf("request %s %s: %v", r.Method, r.URL.Path, err)
+    }
+    return fields["nonce_str"]
+}
+
+func mustAtoi(t *testing.T, s string) int64 {
+    n, err := strconv.ParseInt(s, 10, 64)
+    if err != nil {
+        t.Errorf("invalid number %q", s)
+    }
+    return n
+}
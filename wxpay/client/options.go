@@ -0,0 +1,184 @@
+package client
+
+import (
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "net/url"
+    "strings"
+    "time"
+)
+
+// Option configures a Client
+type Option func(pay *Client) error
+
+// Logger is satisfied by *log.Logger
+type Logger interface {
+    Printf(format string, v ...interface{})
+}
+
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, v ...interface{}) {
+    log.Printf(format, v...)
+}
+
+// NewClient creates a client for the merchant configured by opts
+func NewClient(mchId int64, opts ...Option) (pay *Client, err error) {
+    pay = newClient(mchId)
+    for _, opt := range opts {
+        if err = opt(pay); err != nil {
+            return nil, err
+        }
+    }
+    pay.applyTimeout()
+    return
+}
+
+// WithHTTPClient sets the http client used to send requests
+func WithHTTPClient(httpClient *http.Client) Option {
+    return func(pay *Client) error {
+        if httpClient == nil {
+            return errors.New("wxpay: http client is nil")
+        }
+        pay.client = httpClient
+        return nil
+    }
+}
+
+// WithBaseURL points the client at another endpoint, e.g. a local fake server
+func WithBaseURL(rawurl string) Option {
+    return func(pay *Client) error {
+        if !strings.HasSuffix(rawurl, "/") {
+            rawurl += "/"
+        }
+        baseURL, err := url.Parse(rawurl)
+        if err != nil {
+            return fmt.Errorf("wxpay: invalid base url: %v", err)
+        }
+        pay.BaseURL = baseURL
+        return nil
+    }
+}
+
+// WithTimeout sets the timeout of each http round trip whatever the order of the options,
+// the http client given by WithHTTPClient is copied rather than modified
+func WithTimeout(timeout time.Duration) Option {
+    return func(pay *Client) error {
+        pay.timeout = timeout
+        return nil
+    }
+}
+
+// applyTimeout sets the timeout of WithTimeout once all the options ran
+func (pay *Client) applyTimeout() {
+    if pay.timeout <= 0 {
+        return
+    }
+    httpClient := *pay.client
+    httpClient.Timeout = pay.timeout
+    pay.client = &httpClient
+}
+
+// WithAPIv3Key sets the APIv3 key used to decrypt certificates and notifications
+func WithAPIv3Key(key string) Option {
+    return func(pay *Client) error {
+        if len(key) != 32 {
+            return errors.New("wxpay: APIv3 key must be 32 bytes")
+        }
+        pay.APIv3Key = key
+        return nil
+    }
+}
+
+func WithUserAgent(ua string) Option {
+    return func(pay *Client) error {
+        pay.UserAgent = ua
+        return nil
+    }
+}
+
+func WithSigner(signer Signer) Option {
+    return func(pay *Client) error {
+        pay.Signer = signer
+        return nil
+    }
+}
+
+// WithPrivateKey signs with a PEM encoded PKCS#1 or PKCS#8 private key
+func WithPrivateKey(serialNo, privateKey string) Option {
+    return func(pay *Client) (err error) {
+        signer, err := NewRSASigner(serialNo, privateKey)
+        if err != nil {
+            return
+        }
+        pay.SerialNo = serialNo
+        pay.PrivateKey = privateKey
+        pay.Signer = signer
+        return
+    }
+}
+
+// WithCredential signs with a credential loaded by LoadCredentialFiles, LoadPKCS12File or LoadCredentialFromEnv
+func WithCredential(cred *Credential) Option {
+    return func(pay *Client) (err error) {
+        signer, err := cred.Signer()
+        if err != nil {
+            return
+        }
+        pay.SerialNo = cred.SerialNo
+        pay.Signer = signer
+        return
+    }
+}
+
+func WithVerifier(verifier Verifier) Option {
+    return func(pay *Client) error {
+        pay.Verifier = verifier
+        return nil
+    }
+}
+
+// WithPublicKey verifies with a PEM encoded platform certificate or public key
+func WithPublicKey(publicKey string) Option {
+    return func(pay *Client) (err error) {
+        verifier, err := newVerifier(publicKey)
+        if err != nil {
+            return
+        }
+        pay.PublicKey = publicKey
+        pay.Verifier = verifier
+        return
+    }
+}
+
+func WithMaxClockSkew(skew time.Duration) Option {
+    return func(pay *Client) error {
+        pay.MaxClockSkew = skew
+        return nil
+    }
+}
+
+func WithNonceStore(store NonceStore) Option {
+    return func(pay *Client) error {
+        pay.NonceStore = store
+        return nil
+    }
+}
+
+// WithLogger sets the logger of background errors, the standard logger by default
+func WithLogger(logger Logger) Option {
+    return func(pay *Client) error {
+        if logger == nil {
+            return errors.New("wxpay: logger is nil")
+        }
+        pay.logger = logger
+        return nil
+    }
+}
+
+// Logger returns the logger set by WithLogger
+func (pay *Client) Logger() Logger {
+    return pay.logger
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+    "context"
+)
+
+const defaultPageSize = 10
+
+// PageFunc fetches the page at offset and returns the number of items in it
+// and the total_count of the list
+type PageFunc func(ctx context.Context, offset, limit int) (n, total int, err error)
+
+// Iterator walks offset/limit list endpoints page by page until total_count is reached
+//
+//	it := client.NewIterator(10, fetch)
+//	for it.Next(ctx) {
+//	    ...
+//	}
+//	if err := it.Err(); err != nil {
+//	    ...
+//	}
+type Iterator struct {
+    // PageSize is the limit of each request
+    PageSize int
+    // PageNumbered advances offset by one page instead of by the number of items,
+    // for the APIs whose offset is a page number
+    PageNumbered bool
+
+    fetch   PageFunc
+    offset  int
+    seen    int
+    total   int
+    started bool
+    done    bool
+    err     error
+}
+
+func NewIterator(pageSize int, fetch PageFunc) *Iterator {
+    if pageSize <= 0 {
+        pageSize = defaultPageSize
+    }
+    return &Iterator{PageSize: pageSize, fetch: fetch}
+}
+
+// Next fetches the next page, it returns false when all pages are read or on error
+func (it *Iterator) Next(ctx context.Context) bool {
+    if it.done || it.err != nil {
+        return false
+    }
+    if err := ctx.Err(); err != nil {
+        it.err = err
+        return false
+    }
+    if it.started && it.seen >= it.total {
+        it.done = true
+        return false
+    }
+
+    n, total, err := it.fetch(ctx, it.offset, it.PageSize)
+    if err != nil {
+        it.err = err
+        return false
+    }
+    it.started = true
+    it.total = total
+    it.seen += n
+    if n == 0 {
+        it.done = true
+        return false
+    }
+    if it.PageNumbered {
+        it.offset++
+    } else {
+        it.offset += n
+    }
+    return true
+}
+
+// Err returns the error that stopped the iteration
+func (it *Iterator) Err() error {
+    return it.err
+}
+
+// Total returns the total_count of the last page
+func (it *Iterator) Total() int {
+    return it.total
+}
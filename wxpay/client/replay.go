@@ -0,0 +1,175 @@
+package client
+
+import (
+    "container/list"
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "sync"
+    "time"
+)
+
+const (
+    DefaultMaxClockSkew = 5 * time.Minute
+
+    defaultNonceCapacity = 100000
+)
+
+// neverExpire is later than any nonce expiry
+var neverExpire = time.Unix(1<<62, 0)
+
+var (
+    ErrTimestampSkew = errors.New("wxpay: Wechatpay-Timestamp is out of the allowed clock skew")
+    ErrReplayedNonce = errors.New("wxpay: Wechatpay-Nonce has already been used")
+    // ErrNonceStoreFull is returned rather than forgetting a nonce which could still be replayed
+    ErrNonceStoreFull = errors.New("wxpay: nonce store is full")
+)
+
+// NonceStore remembers the nonces of verified messages to detect replays
+type NonceStore interface {
+    // Add records the nonce until expire, or for good when expire is zero,
+    // and reports false if it is already known
+    Add(nonce string, expire time.Time) (bool, error)
+}
+
+// LRUNonceStore is an in-memory NonceStore holding up to capacity nonces.
+// Expired nonces are dropped to make room, a store full of nonces still valid
+// refuses new ones with ErrNonceStoreFull instead of forgetting any.
+type LRUNonceStore struct {
+    mu       sync.Mutex
+    capacity int
+    ll       *list.List
+    items    map[string]*list.Element
+    // nextExpire is the earliest expiry of the stored nonces, zero until the first sweep
+    nextExpire time.Time
+}
+
+type nonceEntry struct {
+    nonce  string
+    expire time.Time
+}
+
+func NewLRUNonceStore(capacity int) *LRUNonceStore {
+    if capacity <= 0 {
+        capacity = defaultNonceCapacity
+    }
+    return &LRUNonceStore{
+        capacity: capacity,
+        ll:       list.New(),
+        items:    make(map[string]*list.Element),
+    }
+}
+
+func (s *LRUNonceStore) Add(nonce string, expire time.Time) (bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    now := time.Now()
+    if e, ok := s.items[nonce]; ok {
+        if e.Value.(*nonceEntry).alive(now) {
+            return false, nil
+        }
+        s.remove(e)
+    }
+
+    if s.ll.Len() >= s.capacity {
+        s.sweep(now)
+    }
+    if s.ll.Len() >= s.capacity {
+        return false, ErrNonceStoreFull
+    }
+
+    s.items[nonce] = s.ll.PushFront(&nonceEntry{nonce: nonce, expire: expire})
+    if !expire.IsZero() && expire.Before(s.nextExpire) {
+        s.nextExpire = expire
+    }
+    return true, nil
+}
+
+// sweep drops the expired nonces, wherever they are, unless none can have expired yet
+func (s *LRUNonceStore) sweep(now time.Time) {
+    if !s.nextExpire.IsZero() && now.Before(s.nextExpire) {
+        return
+    }
+    s.nextExpire = neverExpire
+    for e := s.ll.Front(); e != nil; {
+        next := e.Next()
+        entry := e.Value.(*nonceEntry)
+        switch {
+        case !entry.alive(now):
+            s.remove(e)
+        case !entry.expire.IsZero() && entry.expire.Before(s.nextExpire):
+            s.nextExpire = entry.expire
+        }
+        e = next
+    }
+}
+
+func (s *LRUNonceStore) remove(e *list.Element) {
+    s.ll.Remove(e)
+    delete(s.items, e.Value.(*nonceEntry).nonce)
+}
+
+func (entry *nonceEntry) alive(now time.Time) bool {
+    return entry.expire.IsZero() || now.Before(entry.expire)
+}
+
+// Verify checks the Wechatpay-* headers of an API response or a notification:
+// the timestamp skew, the signature and, when NonceStore is set, the nonce replay
+func (pay *Client) Verify(ctx context.Context, header http.Header, body []byte) (err error) {
+    timestamp, err := pay.checkTimestamp(header)
+    if err != nil {
+        return
+    }
+    if err = pay.verifySign(ctx, header, body); err != nil {
+        return
+    }
+    return pay.checkNonce(header, timestamp)
+}
+
+// checkTimestamp rejects messages whose Wechatpay-Timestamp is too far from now
+func (pay *Client) checkTimestamp(header http.Header) (timestamp time.Time, err error) {
+    sec, err := strconv.ParseInt(header.Get(headerTimestamp), 10, 64)
+    if err != nil {
+        return timestamp, fmt.Errorf("wxpay: invalid Wechatpay-Timestamp %q", header.Get(headerTimestamp))
+    }
+    timestamp = time.Unix(sec, 0)
+
+    skew := pay.MaxClockSkew
+    if skew == 0 {
+        skew = DefaultMaxClockSkew
+    }
+    if skew < 0 {
+        return
+    }
+    if d := time.Since(timestamp); d > skew || d < -skew {
+        return timestamp, fmt.Errorf("%w: %s", ErrTimestampSkew, timestamp.Format(time.RFC3339))
+    }
+    return
+}
+
+// checkNonce records the Wechatpay-Nonce of a verified message and rejects replays
+func (pay *Client) checkNonce(header http.Header, timestamp time.Time) error {
+    if pay.NonceStore == nil {
+        return nil
+    }
+    // without the timestamp check an old message stays valid for good, so does its nonce
+    var expire time.Time
+    switch skew := pay.MaxClockSkew; {
+    case skew == 0:
+        expire = timestamp.Add(DefaultMaxClockSkew)
+    case skew > 0:
+        expire = timestamp.Add(skew)
+    }
+    nonce := header.Get(headerNonce)
+    ok, err := pay.NonceStore.Add(nonce, expire)
+    if err != nil {
+        return err
+    }
+    if !ok {
+        return fmt.Errorf("%w: %s", ErrReplayedNonce, nonce)
+    }
+    return nil
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+    "testing"
+    "time"
+)
+
+func TestLRUNonceStoreKeepsValidNonces(t *testing.T) {
+    s := NewLRUNonceStore(3)
+    for _, nonce := range []string{"n1", "n2", "n3"} {
+        if ok, err := s.Add(nonce, time.Time{}); !ok || err != nil {
+            t.Fatalf("Add(%s) = %v, %v", nonce, ok, err)
+        }
+    }
+    // nonces kept for good are never evicted, the store refuses new ones instead
+    if ok, err := s.Add("n4", time.Time{}); ok || err != ErrNonceStoreFull {
+        t.Fatalf("Add(n4) = %v, %v, want ErrNonceStoreFull", ok, err)
+    }
+    if ok, err := s.Add("n1", time.Time{}); ok || err != nil {
+        t.Fatalf("replayed n1: Add = %v, %v", ok, err)
+    }
+}
+
+func TestLRUNonceStoreSweepsExpired(t *testing.T) {
+    s := NewLRUNonceStore(3)
+    soon := time.Now().Add(50 * time.Millisecond)
+    s.Add("n1", time.Time{})
+    s.Add("n2", soon)
+    s.Add("n3", time.Time{})
+    if ok, err := s.Add("n4", time.Now().Add(time.Hour)); ok || err != ErrNonceStoreFull {
+        t.Fatalf("Add(n4) = %v, %v before n2 expired", ok, err)
+    }
+
+    // the expired nonce in the middle makes room
+    time.Sleep(100 * time.Millisecond)
+    if ok, err := s.Add("n4", time.Now().Add(time.Hour)); !ok || err != nil {
+        t.Fatalf("Add(n4) = %v, %v after n2 expired", ok, err)
+    }
+    for _, nonce := range []string{"n1", "n3", "n4"} {
+        if ok, _ := s.Add(nonce, time.Time{}); ok {
+            t.Errorf("%s forgotten", nonce)
+        }
+    }
+}
@@ -0,0 +1,200 @@
+package client
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "errors"
+    "io/ioutil"
+    "math"
+    "math/rand"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+// RetryPolicy retries failed requests with exponential backoff and jitter.
+// Network errors, 5xx, SYSTEM_ERROR and FREQUENCY_LIMITED are retried,
+// a POST only when it carries one of IdempotencyKeys or the context is marked by WithIdempotent.
+type RetryPolicy struct {
+    // MaxAttempts counts the first attempt too
+    MaxAttempts    int
+    InitialBackoff time.Duration
+    MaxBackoff     time.Duration
+    Multiplier     float64
+    // Jitter randomly shortens each backoff by up to this fraction
+    Jitter float64
+    // IdempotencyKeys are JSON body fields which make a POST safe to retry
+    IdempotencyKeys []string
+}
+
+func DefaultRetryPolicy() *RetryPolicy {
+    return &RetryPolicy{
+        MaxAttempts:     3,
+        InitialBackoff:  200 * time.Millisecond,
+        MaxBackoff:      5 * time.Second,
+        Multiplier:      2,
+        Jitter:          0.5,
+        IdempotencyKeys: []string{"out_request_no"},
+    }
+}
+
+// WithRetryPolicy enables retries, nil disables them
+func WithRetryPolicy(policy *RetryPolicy) Option {
+    return func(pay *Client) error {
+        pay.RetryPolicy = policy
+        return nil
+    }
+}
+
+type idempotentKey struct{}
+
+// WithIdempotent marks the requests created with ctx as safe to retry regardless of the method
+func WithIdempotent(ctx context.Context) context.Context {
+    return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// send performs the request with the retry policy of the client
+func (pay *Client) send(req *http.Request) (response *http.Response, body []byte, err error) {
+    policy := pay.RetryPolicy
+    if policy == nil || policy.MaxAttempts <= 1 || !policy.retryable(req) {
+        return pay.attempt(req)
+    }
+
+    ctx := req.Context()
+    for attempt := 1; ; attempt++ {
+        response, body, err = pay.attempt(req)
+        if attempt >= policy.MaxAttempts || !shouldRetry(ctx, err) {
+            return
+        }
+
+        wait := policy.backoff(attempt, err)
+        pay.logger.Printf("wxpay: %s %s attempt %d failed: %v, retry in %s", req.Method, req.URL.Path, attempt, err, wait)
+        timer := time.NewTimer(wait)
+        select {
+        case <-ctx.Done():
+            timer.Stop()
+            return response, body, ctx.Err()
+        case <-timer.C:
+        }
+
+        if req, err = pay.resign(req); err != nil {
+            return
+        }
+    }
+}
+
+// resign clones the request with a fresh body, timestamp and nonce
+func (pay *Client) resign(req *http.Request) (clone *http.Request, err error) {
+    clone = req.Clone(req.Context())
+    text, err := requestBody(req)
+    if err != nil {
+        return
+    }
+    if req.GetBody != nil {
+        if clone.Body, err = req.GetBody(); err != nil {
+            return
+        }
+    }
+    err = pay.authorize(clone, signedBody(req, text))
+    return
+}
+
+func requestBody(req *http.Request) (text []byte, err error) {
+    if req.GetBody == nil {
+        return
+    }
+    body, err := req.GetBody()
+    if err != nil {
+        return
+    }
+    defer body.Close()
+    return ioutil.ReadAll(body)
+}
+
+type signedBodyKey struct{}
+
+// signedBody returns the part of the body covered by the signature
+func signedBody(req *http.Request, text []byte) string {
+    if s, ok := req.Context().Value(signedBodyKey{}).(string); ok {
+        return s
+    }
+    return string(text)
+}
+
+func (policy *RetryPolicy) retryable(req *http.Request) bool {
+    return idempotent(req, policy.IdempotencyKeys)
+}
+
+// idempotent reports whether sending req twice has the same effect as sending it once
+func idempotent(req *http.Request, keys []string) bool {
+    switch req.Method {
+    case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+        return true
+    }
+    if idempotent, _ := req.Context().Value(idempotentKey{}).(bool); idempotent {
+        return true
+    }
+    if len(keys) == 0 {
+        return false
+    }
+
+    text, err := requestBody(req)
+    if err != nil || len(text) == 0 {
+        return false
+    }
+    fields := map[string]json.RawMessage{}
+    if err = json.Unmarshal(text, &fields); err != nil {
+        return false
+    }
+    for _, key := range keys {
+        if v, ok := fields[key]; ok && !bytes.Equal(v, []byte(`""`)) && !bytes.Equal(v, []byte("null")) {
+            return true
+        }
+    }
+    return false
+}
+
+func shouldRetry(ctx context.Context, err error) bool {
+    if err == nil || ctx.Err() != nil {
+        return false
+    }
+    var apiErr *APIError
+    if !errors.As(err, &apiErr) {
+        // network error
+        return true
+    }
+    return apiErr.StatusCode >= http.StatusInternalServerError || IsSystemError(err) || IsFrequencyLimited(err)
+}
+
+func (policy *RetryPolicy) backoff(attempt int, err error) time.Duration {
+    d := float64(policy.InitialBackoff) * math.Pow(policy.Multiplier, float64(attempt-1))
+    if policy.MaxBackoff > 0 && d > float64(policy.MaxBackoff) {
+        d = float64(policy.MaxBackoff)
+    }
+    if policy.Jitter > 0 {
+        d -= d * policy.Jitter * rand.Float64()
+    }
+    wait := time.Duration(d)
+
+    if apiErr, ok := AsAPIError(err); ok && apiErr.retryAfter > wait {
+        wait = apiErr.retryAfter
+    }
+    return wait
+}
+
+// parseRetryAfter parses the Retry-After header in seconds or HTTP date
+func parseRetryAfter(value string) time.Duration {
+    if value == "" {
+        return 0
+    }
+    if sec, err := strconv.Atoi(value); err == nil && sec > 0 {
+        return time.Duration(sec) * time.Second
+    }
+    if t, err := http.ParseTime(value); err == nil {
+        if d := time.Until(t); d > 0 {
+            return d
+        }
+    }
+    return 0
+}
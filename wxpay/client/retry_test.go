@@ -0,0 +1,133 @@
+package client
+
+import (
+    "context"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+)
+
+func fastRetryPolicy() *RetryPolicy {
+    policy := DefaultRetryPolicy()
+    policy.InitialBackoff = time.Millisecond
+    policy.MaxBackoff = 10 * time.Millisecond
+    return policy
+}
+
+// failingServer answers every request with status and body, recording the request nonces
+type failingServer struct {
+    t      *testing.T
+    status int
+    body   string
+    header http.Header
+
+    mu     sync.Mutex
+    nonces []string
+}
+
+func (s *failingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    body, _ := ioutil.ReadAll(r.Body)
+    nonce := verifyRequest(s.t, r, body)
+    s.mu.Lock()
+    s.nonces = append(s.nonces, nonce)
+    s.mu.Unlock()
+    for k, v := range s.header {
+        w.Header()[k] = v
+    }
+    writeSigned(s.t, w, s.status, s.body)
+}
+
+func (s *failingServer) attempts() int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return len(s.nonces)
+}
+
+func TestRetryPostOnlyWithOutRequestNo(t *testing.T) {
+    tests := []struct {
+        name string
+        body interface{}
+        want int
+    }{
+        {"without out_request_no", map[string]string{"stock_id": "1"}, 1},
+        {"with empty out_request_no", map[string]string{"out_request_no": ""}, 1},
+        {"with out_request_no", map[string]string{"out_request_no": "req-1"}, 3},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            srv := &failingServer{t: t, status: http.StatusInternalServerError, body: `{"code":"SYSTEM_ERROR","message":"busy"}`}
+            ts := httptest.NewServer(srv)
+            defer ts.Close()
+            c := newTestClient(t, ts.URL, WithRetryPolicy(fastRetryPolicy()))
+
+            req, err := c.NewRequest(context.Background(), http.MethodPost, "marketing/favor/users/o1/coupons", tt.body)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if err = c.Do(req, nil); !IsSystemError(err) {
+                t.Errorf("error %v, want SYSTEM_ERROR", err)
+            }
+            if n := srv.attempts(); n != tt.want {
+                t.Errorf("%d attempts, want %d", n, tt.want)
+            }
+        })
+    }
+}
+
+func TestRetryResignsEachAttempt(t *testing.T) {
+    srv := &failingServer{t: t, status: http.StatusServiceUnavailable, body: `{"code":"SYSTEM_ERROR","message":"busy"}`}
+    ts := httptest.NewServer(srv)
+    defer ts.Close()
+    c := newTestClient(t, ts.URL, WithRetryPolicy(fastRetryPolicy()))
+
+    req, err := c.NewRequest(context.Background(), http.MethodPost, "marketing/favor/users/o1/coupons",
+        map[string]string{"out_request_no": "req-1"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    c.Do(req, nil)
+
+    // verifyRequest has checked each signature, each attempt must carry a fresh nonce
+    seen := map[string]bool{}
+    for _, nonce := range srv.nonces {
+        if seen[nonce] {
+            t.Errorf("nonce %s sent twice", nonce)
+        }
+        seen[nonce] = true
+    }
+    if len(srv.nonces) != 3 {
+        t.Errorf("%d attempts, want 3", len(srv.nonces))
+    }
+}
+
+func TestRetryAfter(t *testing.T) {
+    srv := &failingServer{
+        t:      t,
+        status: http.StatusTooManyRequests,
+        body:   `{"code":"FREQUENCY_LIMITED","message":"slow down"}`,
+        header: http.Header{"Retry-After": {"1"}},
+    }
+    ts := httptest.NewServer(srv)
+    defer ts.Close()
+    policy := fastRetryPolicy()
+    policy.MaxAttempts = 2
+    c := newTestClient(t, ts.URL, WithRetryPolicy(policy))
+
+    req, err := c.NewRequest(context.Background(), http.MethodGet, "marketing/favor/stocks/1", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    start := time.Now()
+    if err = c.Do(req, nil); !IsFrequencyLimited(err) {
+        t.Errorf("error %v, want FREQUENCY_LIMITED", err)
+    }
+    if elapsed := time.Since(start); elapsed < time.Second {
+        t.Errorf("retried after %s, want at least the Retry-After of 1s", elapsed)
+    }
+    if n := srv.attempts(); n != 2 {
+        t.Errorf("%d attempts, want 2", n)
+    }
+}
@@ -0,0 +1,270 @@
+package client
+
+import (
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha1"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "reflect"
+    "strings"
+    "time"
+)
+
+// 敏感信息加解密
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wechatpay/wechatpay4_3.shtml
+const (
+    tagName    = "wxpay"
+    tagEncrypt = "encrypt"
+)
+
+var ErrNoEncryptionKey = errors.New("wxpay: no platform key available to encrypt sensitive fields")
+
+// EncryptionKeyProvider supplies the platform key that sensitive fields are encrypted with,
+// CertificateManager and CertificateVerifier implement it
+type EncryptionKeyProvider interface {
+    EncryptionKey() (serialNo string, key *rsa.PublicKey, err error)
+}
+
+func (m *CertificateManager) EncryptionKey() (serialNo string, key *rsa.PublicKey, err error) {
+    cert, err := m.Latest()
+    if err != nil {
+        return
+    }
+    return cert.SerialNo, cert.PublicKey(), nil
+}
+
+// EncryptionKey returns the WeChat Pay public key if one was added,
+// otherwise the valid platform certificate which expires last
+func (v *CertificateVerifier) EncryptionKey() (serialNo string, key *rsa.PublicKey, err error) {
+    v.mu.RLock()
+    defer v.mu.RUnlock()
+    if v.publicKey != "" {
+        return v.publicKey, v.keys[strings.ToUpper(v.publicKey)], nil
+    }
+    now := time.Now()
+    var notAfter time.Time
+    for serial, expire := range v.expires {
+        if now.Before(expire) && expire.After(notAfter) {
+            serialNo, notAfter = serial, expire
+        }
+    }
+    if serialNo == "" {
+        return "", nil, ErrNoEncryptionKey
+    }
+    return serialNo, v.keys[serialNo], nil
+}
+
+func (vs MultiVerifier) EncryptionKey() (serialNo string, key *rsa.PublicKey, err error) {
+    for _, v := range vs {
+        if p, ok := v.(EncryptionKeyProvider); ok {
+            if serialNo, key, err = p.EncryptionKey(); err == nil {
+                return
+            }
+        }
+    }
+    return "", nil, ErrNoEncryptionKey
+}
+
+// EncryptionKey returns the platform key of the Verifier
+func (pay *Client) EncryptionKey() (serialNo string, key *rsa.PublicKey, err error) {
+    p, ok := pay.Verifier.(EncryptionKeyProvider)
+    if !ok {
+        return "", nil, ErrNoEncryptionKey
+    }
+    return p.EncryptionKey()
+}
+
+// EncryptSensitive encrypts one field with the platform key, the returned serial number
+// must be sent in the Wechatpay-Serial header
+func (pay *Client) EncryptSensitive(plaintext string) (ciphertext, serialNo string, err error) {
+    serialNo, key, err := pay.EncryptionKey()
+    if err != nil {
+        return
+    }
+    ciphertext, err = EncryptOAEP(key, plaintext)
+    return
+}
+
+// DecryptSensitive decrypts one field of a response with the merchant private key
+func (pay *Client) DecryptSensitive(ciphertext string) (plaintext string, err error) {
+    signer, ok := pay.Signer.(*RSASigner)
+    if !ok {
+        return "", errors.New("wxpay: decrypting sensitive fields requires a RSASigner")
+    }
+    return DecryptOAEP(signer.key, ciphertext)
+}
+
+// DecryptFields decrypts in place the string fields of v tagged `wxpay:"encrypt"`
+func (pay *Client) DecryptFields(v interface{}) error {
+    rv := reflect.ValueOf(v)
+    if rv.Kind() != reflect.Ptr || rv.IsNil() {
+        return errors.New("wxpay: DecryptFields requires a non-nil pointer")
+    }
+    return transformFields(rv, pay.DecryptSensitive)
+}
+
+// EncryptOAEP encrypts with RSAES-OAEP and SHA-1 and encodes the result in base64
+func EncryptOAEP(key *rsa.PublicKey, plaintext string) (ciphertext string, err error) {
+    b, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, key, []byte(plaintext), nil)
+    if err != nil {
+        return
+    }
+    return base64.StdEncoding.EncodeToString(b), nil
+}
+
+func DecryptOAEP(key *rsa.PrivateKey, ciphertext string) (plaintext string, err error) {
+    b, err := base64.StdEncoding.DecodeString(ciphertext)
+    if err != nil {
+        return
+    }
+    b, err = rsa.DecryptOAEP(sha1.New(), rand.Reader, key, b, nil)
+    if err != nil {
+        return
+    }
+    return string(b), nil
+}
+
+// encryptBody returns a copy of body whose `wxpay:"encrypt"` fields are encrypted,
+// serialNo is empty when body has no such field
+func (pay *Client) encryptBody(body interface{}) (encrypted interface{}, serialNo string, err error) {
+    rv := reflect.ValueOf(body)
+    if !hasSensitive(rv.Type(), map[reflect.Type]bool{}) {
+        return body, "", nil
+    }
+    // the key is only required when a tagged field is set
+    var key *rsa.PublicKey
+    copied, err := copyFields(rv, func(s string) (text string, err error) {
+        if key == nil {
+            if serialNo, key, err = pay.EncryptionKey(); err != nil {
+                return
+            }
+        }
+        return EncryptOAEP(key, s)
+    })
+    if err != nil {
+        return
+    }
+    if serialNo == "" {
+        return body, "", nil
+    }
+    return copied.Interface(), serialNo, nil
+}
+
+// hasSensitive reports whether values of t may hold a `wxpay:"encrypt"` field
+func hasSensitive(t reflect.Type, seen map[reflect.Type]bool) bool {
+    if seen[t] {
+        return false
+    }
+    seen[t] = true
+    switch t.Kind() {
+    case reflect.Ptr, reflect.Slice, reflect.Array:
+        return hasSensitive(t.Elem(), seen)
+    case reflect.Interface:
+        // decided by the dynamic value
+        return true
+    case reflect.Struct:
+        for i := 0; i < t.NumField(); i++ {
+            f := t.Field(i)
+            if f.PkgPath != "" {
+                continue
+            }
+            if isSensitive(f) || hasSensitive(f.Type, seen) {
+                return true
+            }
+        }
+    }
+    return false
+}
+
+func isSensitive(f reflect.StructField) bool {
+    return f.Type.Kind() == reflect.String && f.Tag.Get(tagName) == tagEncrypt
+}
+
+// copyFields deep copies v, passing the tagged string fields through fn
+func copyFields(v reflect.Value, fn func(string) (string, error)) (reflect.Value, error) {
+    switch v.Kind() {
+    case reflect.Ptr:
+        if v.IsNil() {
+            return v, nil
+        }
+        elem, err := copyFields(v.Elem(), fn)
+        if err != nil {
+            return v, err
+        }
+        p := reflect.New(elem.Type())
+        p.Elem().Set(elem)
+        return p, nil
+    case reflect.Interface:
+        if v.IsNil() {
+            return v, nil
+        }
+        elem, err := copyFields(v.Elem(), fn)
+        if err != nil {
+            return v, err
+        }
+        i := reflect.New(v.Type()).Elem()
+        i.Set(elem)
+        return i, nil
+    case reflect.Slice:
+        if v.IsNil() {
+            return v, nil
+        }
+        s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+        for i := 0; i < v.Len(); i++ {
+            elem, err := copyFields(v.Index(i), fn)
+            if err != nil {
+                return v, err
+            }
+            s.Index(i).Set(elem)
+        }
+        return s, nil
+    case reflect.Struct:
+        s := reflect.New(v.Type()).Elem()
+        s.Set(v)
+        err := transformFields(s.Addr(), fn)
+        return s, err
+    }
+    return v, nil
+}
+
+// transformFields passes the tagged string fields of the struct pointed by v through fn in place,
+// nested pointers, slices and interfaces are copied first so that shared values are left untouched
+func transformFields(v reflect.Value, fn func(string) (string, error)) (err error) {
+    s := v.Elem()
+    if s.Kind() != reflect.Struct {
+        return
+    }
+    t := s.Type()
+    for i := 0; i < t.NumField(); i++ {
+        f := t.Field(i)
+        if f.PkgPath != "" {
+            continue
+        }
+        field := s.Field(i)
+        if isSensitive(f) {
+            if field.String() == "" {
+                continue
+            }
+            var text string
+            if text, err = fn(field.String()); err != nil {
+                return fmt.Errorf("wxpay: field %s: %v", f.Name, err)
+            }
+            field.SetString(text)
+            continue
+        }
+        switch field.Kind() {
+        case reflect.Ptr, reflect.Interface, reflect.Slice, reflect.Struct:
+            if !hasSensitive(f.Type, map[reflect.Type]bool{}) {
+                continue
+            }
+            var copied reflect.Value
+            if copied, err = copyFields(field, fn); err != nil {
+                return
+            }
+            field.Set(copied)
+        }
+    }
+    return
+}
@@ -0,0 +1,100 @@
+package client
+
+import (
+    "math/big"
+    "testing"
+    "time"
+)
+
+type testContact struct {
+    Name   string `json:"name" wxpay:"encrypt"`
+    Mobile string `json:"mobile" wxpay:"encrypt"`
+    Note   string `json:"note"`
+}
+
+type testApplyment struct {
+    Contact  *testContact   `json:"contact"`
+    Owners   []*testContact `json:"owners"`
+    IDNumber string         `json:"id_number" wxpay:"encrypt"`
+}
+
+func TestEncryptBodyRoundTrip(t *testing.T) {
+    c := newTestClient(t, "http://127.0.0.1")
+    body := &testApplyment{
+        Contact:  &testContact{Name: "张三", Mobile: "13800000000", Note: "plain"},
+        Owners:   []*testContact{{Name: "李四"}},
+        IDNumber: "110101199003071234",
+    }
+
+    encrypted, serialNo, err := c.encryptBody(body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if serialNo != testSerialNo {
+        t.Fatalf("serial %q, want %q", serialNo, testSerialNo)
+    }
+
+    // the caller's struct and the values it points to are left untouched
+    if body.Contact.Name != "张三" || body.Contact.Mobile != "13800000000" ||
+        body.Owners[0].Name != "李四" || body.IDNumber != "110101199003071234" {
+        t.Fatalf("body modified: %+v %+v %+v", body, body.Contact, body.Owners[0])
+    }
+
+    got := encrypted.(*testApplyment)
+    if got.Contact.Name == "张三" || got.Owners[0].Name == "李四" || got.IDNumber == body.IDNumber {
+        t.Fatal("tagged fields are not encrypted")
+    }
+    if got.Contact.Note != "plain" {
+        t.Fatalf("untagged field changed to %q", got.Contact.Note)
+    }
+    if got.Owners[0].Mobile != "" {
+        t.Fatalf("empty field encrypted to %q", got.Owners[0].Mobile)
+    }
+
+    if err = c.DecryptFields(got); err != nil {
+        t.Fatal(err)
+    }
+    if got.Contact.Name != "张三" || got.Contact.Mobile != "13800000000" ||
+        got.Owners[0].Name != "李四" || got.IDNumber != "110101199003071234" {
+        t.Fatalf("round trip: %+v %+v %+v", got, got.Contact, got.Owners[0])
+    }
+}
+
+func TestEncryptBodyWithoutSensitiveFields(t *testing.T) {
+    c := newTestClient(t, "http://127.0.0.1")
+    body := &testApplyment{Contact: &testContact{Note: "plain"}}
+    encrypted, serialNo, err := c.encryptBody(body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if serialNo != "" || encrypted != body {
+        t.Fatalf("got serial %q and a copy of a body without sensitive value", serialNo)
+    }
+}
+
+func TestCertificateVerifierEncryptionKey(t *testing.T) {
+    key := newTestKey(t)
+    now := time.Now()
+    newer := newTestCertificate(t, key, big.NewInt(0x0A), now.Add(48*time.Hour))
+    older := newTestCertificate(t, key, big.NewInt(0x0B), now.Add(24*time.Hour))
+    expired := newTestCertificate(t, key, big.NewInt(0x0C), now.Add(-time.Minute))
+
+    // the order of addition does not matter, only the expiry
+    v := NewCertificateVerifier(newer, older, expired)
+    serialNo, _, err := v.EncryptionKey()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if serialNo != CertificateSerialNo(newer) {
+        t.Fatalf("encrypt with %s, want %s", serialNo, CertificateSerialNo(newer))
+    }
+
+    if _, _, err = NewCertificateVerifier(expired).EncryptionKey(); err != ErrNoEncryptionKey {
+        t.Fatalf("expired certificate: got %v", err)
+    }
+
+    v.AddPublicKey(PublicKeyIDPrefix+"0001", &key.PublicKey)
+    if serialNo, _, _ = v.EncryptionKey(); serialNo != PublicKeyIDPrefix+"0001" {
+        t.Fatalf("encrypt with %s, want the public key", serialNo)
+    }
+}
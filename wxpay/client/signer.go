@@ -0,0 +1,93 @@
+package client
+
+import (
+    "context"
+    "crypto"
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/pem"
+    "errors"
+    "fmt"
+)
+
+var ErrNoSigner = errors.New("wxpay: no signer configured")
+
+// Signer signs request messages with the merchant private key
+type Signer interface {
+    // Sign returns the base64 encoded SHA256-RSA signature of message
+    // and the serial number of the merchant certificate that holds the key
+    Sign(ctx context.Context, message []byte) (signature, serialNo string, err error)
+}
+
+// SignerFunc adapts a function to a Signer, e.g. a call to a separate signing process
+type SignerFunc func(ctx context.Context, message []byte) (signature, serialNo string, err error)
+
+func (f SignerFunc) Sign(ctx context.Context, message []byte) (signature, serialNo string, err error) {
+    return f(ctx, message)
+}
+
+// RSASigner signs with a private key parsed once at construction
+type RSASigner struct {
+    serialNo string
+    key      *rsa.PrivateKey
+}
+
+// NewRSASigner parses a PKCS#1 or PKCS#8 PEM encoded private key
+func NewRSASigner(serialNo, privateKey string) (signer *RSASigner, err error) {
+    key, err := ParsePrivateKey(privateKey)
+    if err != nil {
+        return
+    }
+    return NewRSASignerFromKey(serialNo, key)
+}
+
+func NewRSASignerFromKey(serialNo string, key *rsa.PrivateKey) (signer *RSASigner, err error) {
+    if serialNo == "" {
+        return nil, errors.New("wxpay: merchant serial number is empty")
+    }
+    if key == nil {
+        return nil, errors.New("wxpay: private key is nil")
+    }
+    if err = key.Validate(); err != nil {
+        return nil, fmt.Errorf("wxpay: invalid private key: %v", err)
+    }
+    return &RSASigner{serialNo: serialNo, key: key}, nil
+}
+
+func (s *RSASigner) Sign(ctx context.Context, message []byte) (signature, serialNo string, err error) {
+    hash := sha256.Sum256(message)
+    sign, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, hash[:])
+    if err != nil {
+        return
+    }
+    return base64.StdEncoding.EncodeToString(sign), s.serialNo, nil
+}
+
+// ParsePrivateKey parses a PEM encoded RSA private key in PKCS#1 or PKCS#8 form
+func ParsePrivateKey(text string) (key *rsa.PrivateKey, err error) {
+    block, _ := pem.Decode([]byte(text))
+    if block == nil {
+        return nil, errors.New("wxpay: invalid private key: no PEM block found")
+    }
+    switch block.Type {
+    case "RSA PRIVATE KEY":
+        key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+    default:
+        var k interface{}
+        k, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+        if err != nil {
+            break
+        }
+        var ok bool
+        if key, ok = k.(*rsa.PrivateKey); !ok {
+            err = errors.New("not a RSA key")
+        }
+    }
+    if err != nil {
+        return nil, fmt.Errorf("wxpay: invalid private key: %v", err)
+    }
+    return
+}
@@ -0,0 +1,11 @@
+package client
+
+import (
+    "testing"
+)
+
+func TestNewRSASignerFromNilKey(t *testing.T) {
+    if _, err := NewRSASignerFromKey(testSerialNo, nil); err == nil {
+        t.Fatal("nil key accepted")
+    }
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "mime/multipart"
+    "net/http"
+    "net/textproto"
+    "path/filepath"
+    "strings"
+)
+
+// MediaMeta is the signed part of a media upload
+type MediaMeta struct {
+    Filename string `json:"filename"`
+    Sha256   string `json:"sha256"`
+}
+
+var mediaTypes = map[string]string{
+    ".jpg":  "image/jpeg",
+    ".jpeg": "image/jpeg",
+    ".png":  "image/png",
+    ".bmp":  "image/bmp",
+    ".avi":  "video/x-msvideo",
+    ".wmv":  "video/x-ms-wmv",
+    ".mpeg": "video/mpeg",
+    ".mp4":  "video/mp4",
+    ".mov":  "video/quicktime",
+    ".mkv":  "video/x-matroska",
+    ".flv":  "video/x-flv",
+    ".f4v":  "video/x-f4v",
+    ".m4v":  "video/x-m4v",
+    ".rmvb": "application/vnd.rn-realmedia-vbr",
+}
+
+// ValidateMedia checks the extension of filename against exts and the size of content
+func ValidateMedia(filename string, content []byte, exts []string, maxSize int) error {
+    ext := strings.ToLower(filepath.Ext(filename))
+    allowed := false
+    for _, e := range exts {
+        if ext == e {
+            allowed = true
+            break
+        }
+    }
+    if !allowed {
+        return fmt.Errorf("wxpay: unsupported media type %q, expect one of %s", ext, strings.Join(exts, " "))
+    }
+    if len(content) == 0 {
+        return fmt.Errorf("wxpay: media %s is empty", filename)
+    }
+    if len(content) > maxSize {
+        return fmt.Errorf("wxpay: media %s is %d bytes, exceeds %d bytes", filename, len(content), maxSize)
+    }
+    return nil
+}
+
+// NewUploadRequest creates a signed multipart request of the media upload APIs,
+// only the meta JSON is covered by the signature
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/tool/chapter3_1.shtml
+func (pay *Client) NewUploadRequest(ctx context.Context, rawurl, filename string, content []byte) (req *http.Request, err error) {
+    u, err := pay.resolve(rawurl)
+    if err != nil {
+        return
+    }
+
+    sum := sha256.Sum256(content)
+    meta, err := json.Marshal(&MediaMeta{
+        Filename: filepath.Base(filename),
+        Sha256:   hex.EncodeToString(sum[:]),
+    })
+    if err != nil {
+        return
+    }
+
+    buf := &bytes.Buffer{}
+    w := multipart.NewWriter(buf)
+    header := textproto.MIMEHeader{}
+    header.Set("Content-Disposition", `form-data; name="meta"`)
+    header.Set("Content-Type", defaultMediaType)
+    part, err := w.CreatePart(header)
+    if err != nil {
+        return
+    }
+    if _, err = part.Write(meta); err != nil {
+        return
+    }
+
+    contentType, ok := mediaTypes[strings.ToLower(filepath.Ext(filename))]
+    if !ok {
+        contentType = "application/octet-stream"
+    }
+    header = textproto.MIMEHeader{}
+    header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, filepath.Base(filename)))
+    header.Set("Content-Type", contentType)
+    if part, err = w.CreatePart(header); err != nil {
+        return
+    }
+    if _, err = part.Write(content); err != nil {
+        return
+    }
+    if err = w.Close(); err != nil {
+        return
+    }
+
+    // retries and failover re-sign the meta rather than the whole body,
+    // uploading the same content twice yields the same media
+    ctx = context.WithValue(WithIdempotent(ctx), signedBodyKey{}, string(meta))
+    req, err = http.NewRequestWithContext(ctx, http.MethodPost, u.String(), buf)
+    if err != nil {
+        return
+    }
+
+    req.Header.Set("Content-Type", w.FormDataContentType())
+    req.Header.Set("User-Agent", pay.UserAgent)
+    req.Header.Set("Accept", defaultMediaType)
+    err = pay.authorize(req, string(meta))
+
+    return
+}
@@ -0,0 +1,261 @@
+package client
+
+import (
+    "context"
+    "crypto"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "sync"
+    "time"
+)
+
+// PublicKeyIDPrefix is the Wechatpay-Serial prefix used in the WeChat Pay public key mode
+// https://pay.weixin.qq.com/doc/v3/merchant/4012153196
+const PublicKeyIDPrefix = "PUB_KEY_ID_"
+
+// minimal period between two refreshes triggered by unknown serials
+const minRefreshInterval = time.Minute
+
+var (
+    // ErrUnknownSerial is returned by a Verifier which holds no key for the Wechatpay-Serial
+    ErrUnknownSerial = errors.New("wxpay: unknown Wechatpay-Serial")
+    ErrNoVerifier    = errors.New("wxpay: no verifier configured")
+)
+
+// Verifier verifies WeChat Pay signatures with the key selected by serial number
+type Verifier interface {
+    Verify(serialNo string, message []byte, signature string) error
+}
+
+// refresher is implemented by verifiers that can reload their keys when meeting an unknown serial
+type refresher interface {
+    Refresh(ctx context.Context) error
+}
+
+// CertificateVerifier holds a fixed set of platform certificates and WeChat Pay public keys
+type CertificateVerifier struct {
+    mu   sync.RWMutex
+    keys map[string]*rsa.PublicKey
+    // expires holds the NotAfter of the certificates by serial number
+    expires map[string]time.Time
+    // publicKey is the id of the last WeChat Pay public key added
+    publicKey string
+}
+
+func NewCertificateVerifier(certs ...*x509.Certificate) *CertificateVerifier {
+    v := &CertificateVerifier{
+        keys:    make(map[string]*rsa.PublicKey),
+        expires: make(map[string]time.Time),
+    }
+    for _, cert := range certs {
+        v.AddCertificate(cert)
+    }
+    return v
+}
+
+// NewPublicKeyVerifier creates a verifier for the WeChat Pay public key mode,
+// keyID is the PUB_KEY_ID_... identifier shown in the merchant platform
+func NewPublicKeyVerifier(keyID, publicKey string) (v *CertificateVerifier, err error) {
+    if !strings.HasPrefix(keyID, PublicKeyIDPrefix) {
+        return nil, fmt.Errorf("wxpay: public key id %q must start with %s", keyID, PublicKeyIDPrefix)
+    }
+    key, err := ParsePublicKey(publicKey)
+    if err != nil {
+        return
+    }
+    v = NewCertificateVerifier()
+    v.AddPublicKey(keyID, key)
+    return
+}
+
+// AddCertificate registers a platform certificate by its serial number
+func (v *CertificateVerifier) AddCertificate(cert *x509.Certificate) {
+    key, ok := cert.PublicKey.(*rsa.PublicKey)
+    if !ok {
+        return
+    }
+    serialNo := CertificateSerialNo(cert)
+    v.mu.Lock()
+    defer v.mu.Unlock()
+    v.keys[serialNo] = key
+    v.expires[serialNo] = cert.NotAfter
+}
+
+// AddPublicKey registers a key by serial number or public key id,
+// the last key added this way is preferred by EncryptionKey
+func (v *CertificateVerifier) AddPublicKey(serialNo string, key *rsa.PublicKey) {
+    v.mu.Lock()
+    defer v.mu.Unlock()
+    v.keys[strings.ToUpper(serialNo)] = key
+    v.publicKey = serialNo
+}
+
+func (v *CertificateVerifier) Verify(serialNo string, message []byte, signature string) error {
+    v.mu.RLock()
+    key, ok := v.keys[strings.ToUpper(serialNo)]
+    v.mu.RUnlock()
+    if !ok {
+        return fmt.Errorf("%w: %s", ErrUnknownSerial, serialNo)
+    }
+    return verifyMessage(key, message, signature)
+}
+
+// Verify implements Verifier with the downloaded platform certificates
+func (m *CertificateManager) Verify(serialNo string, message []byte, signature string) error {
+    cert, ok := m.Get(serialNo)
+    if !ok {
+        return fmt.Errorf("%w: %s", ErrUnknownSerial, serialNo)
+    }
+    return verifyMessage(cert.PublicKey(), message, signature)
+}
+
+// refreshIfStale refreshes unless a download was attempted very recently, successful or not,
+// so that forged serials can not make us hammer the certificates API
+func (m *CertificateManager) refreshIfStale(ctx context.Context) error {
+    m.mu.Lock()
+    if time.Since(m.lastAttempt) < minRefreshInterval {
+        m.mu.Unlock()
+        return nil
+    }
+    m.lastAttempt = time.Now()
+    m.mu.Unlock()
+    return m.Refresh(ctx)
+}
+
+// MultiVerifier tries each verifier in order until one of them knows the serial,
+// e.g. a CertificateManager together with a public key verifier during migration
+type MultiVerifier []Verifier
+
+func (vs MultiVerifier) Verify(serialNo string, message []byte, signature string) (err error) {
+    err = fmt.Errorf("%w: %s", ErrUnknownSerial, serialNo)
+    for _, v := range vs {
+        err = v.Verify(serialNo, message, signature)
+        if !errors.Is(err, ErrUnknownSerial) {
+            return
+        }
+    }
+    return
+}
+
+func (vs MultiVerifier) Refresh(ctx context.Context) (err error) {
+    for _, v := range vs {
+        if _, err = refreshVerifier(ctx, v); err != nil {
+            return
+        }
+    }
+    return
+}
+
+// refreshVerifier reloads the keys of v if it supports it
+func refreshVerifier(ctx context.Context, v Verifier) (ok bool, err error) {
+    switch r := v.(type) {
+    case *CertificateManager:
+        return true, r.refreshIfStale(ctx)
+    case refresher:
+        return true, r.Refresh(ctx)
+    }
+    return false, nil
+}
+
+// staticVerifier uses one key for every serial, it keeps the behaviour of the PublicKey given to New
+type staticVerifier struct {
+    key *rsa.PublicKey
+}
+
+func (v *staticVerifier) Verify(serialNo string, message []byte, signature string) error {
+    return verifyMessage(v.key, message, signature)
+}
+
+// ParsePublicKey parses a PEM encoded PKIX public key or certificate
+func ParsePublicKey(text string) (key *rsa.PublicKey, err error) {
+    block, _ := pem.Decode([]byte(text))
+    if block == nil {
+        return nil, errors.New("wxpay: invalid public key")
+    }
+    var pub interface{}
+    switch block.Type {
+    case "CERTIFICATE":
+        var cert *x509.Certificate
+        cert, err = x509.ParseCertificate(block.Bytes)
+        if err != nil {
+            return
+        }
+        pub = cert.PublicKey
+    default:
+        pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+        if err != nil {
+            return
+        }
+    }
+    key, ok := pub.(*rsa.PublicKey)
+    if !ok {
+        return nil, errors.New("wxpay: public key is not a RSA key")
+    }
+    return
+}
+
+// newVerifier builds the verifier for the PEM given to New, certificates are selected by serial
+func newVerifier(text string) (v Verifier, err error) {
+    block, _ := pem.Decode([]byte(text))
+    if block != nil && block.Type == "CERTIFICATE" {
+        var cert *x509.Certificate
+        cert, err = x509.ParseCertificate(block.Bytes)
+        if err != nil {
+            return
+        }
+        return NewCertificateVerifier(cert), nil
+    }
+    key, err := ParsePublicKey(text)
+    if err != nil {
+        return
+    }
+    return &staticVerifier{key: key}, nil
+}
+
+func (pay *Client) verifySign(ctx context.Context, header http.Header, body []byte) (err error) {
+    if pay.Verifier == nil {
+        return ErrNoVerifier
+    }
+    serialNo := header.Get(headerSerial)
+    message := []byte(fmt.Sprintf("%s\n%s\n%s\n", header.Get(headerTimestamp), header.Get(headerNonce), string(body)))
+    signature := header.Get(headerSignature)
+
+    err = pay.Verifier.Verify(serialNo, message, signature)
+    if !errors.Is(err, ErrUnknownSerial) {
+        return
+    }
+
+    // the platform certificate may just have been rotated
+    ok, refreshErr := refreshVerifier(ctx, pay.Verifier)
+    if !ok {
+        return
+    }
+    if refreshErr != nil {
+        return fmt.Errorf("%w (refresh: %v)", err, refreshErr)
+    }
+    return pay.Verifier.Verify(serialNo, message, signature)
+}
+
+func verifySignature(key *rsa.PublicKey, header http.Header, body []byte) error {
+    message := fmt.Sprintf("%s\n%s\n%s\n", header.Get(headerTimestamp), header.Get(headerNonce), string(body))
+    return verifyMessage(key, []byte(message), header.Get(headerSignature))
+}
+
+func verifyMessage(key *rsa.PublicKey, message []byte, signature string) (err error) {
+    decodeString, err := base64.StdEncoding.DecodeString(signature)
+    if err != nil {
+        return
+    }
+
+    hash := sha256.New()
+    hash.Write(message)
+
+    return rsa.VerifyPKCS1v15(key, crypto.SHA256, hash.Sum(nil), decodeString)
+}
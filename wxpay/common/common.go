@@ -0,0 +1,17 @@
+package common
+
+import (
+    "github.com/yunlyz/go-wechat/wxpay/client"
+)
+
+// Common API V3文档-通用接口
+type Common struct {
+    Media *MediaService
+}
+
+func New(srv *client.Service) *Common {
+    common := &Common{}
+    common.Media = (*MediaService)(srv)
+
+    return common
+}
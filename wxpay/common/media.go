@@ -0,0 +1,72 @@
+package common
+
+import (
+    "context"
+    "io/ioutil"
+
+    "github.com/yunlyz/go-wechat/wxpay/client"
+)
+
+const (
+    maxImageSize = 2 << 20
+    maxVideoSize = 5 << 20
+)
+
+var (
+    imageExts = []string{".jpg", ".jpeg", ".bmp", ".png"}
+    videoExts = []string{".avi", ".wmv", ".mpeg", ".mp4", ".mov", ".mkv", ".flv", ".f4v", ".m4v", ".rmvb"}
+)
+
+type MediaService client.Service
+
+type UploadResponse struct {
+    MediaID string `json:"media_id"`
+}
+
+// UploadImage 图片上传
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/tool/chapter3_1.shtml
+// 支持JPG、BMP、PNG格式，文件大小不能超过2M
+func (srv *MediaService) UploadImage(ctx context.Context, filename string, content []byte) (rsp *UploadResponse, err error) {
+    return srv.upload(ctx, "merchant/media/upload", filename, content, imageExts, maxImageSize)
+}
+
+// UploadVideo 视频上传
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/tool/chapter3_2.shtml
+// 支持avi、wmv、mpeg、mp4、mov、mkv、flv、f4v、m4v、rmvb格式，文件大小不能超过5M
+func (srv *MediaService) UploadVideo(ctx context.Context, filename string, content []byte) (rsp *UploadResponse, err error) {
+    return srv.upload(ctx, "merchant/media/video_upload", filename, content, videoExts, maxVideoSize)
+}
+
+// UploadImageFile reads and uploads a local image
+func (srv *MediaService) UploadImageFile(ctx context.Context, path string) (rsp *UploadResponse, err error) {
+    content, err := ioutil.ReadFile(path)
+    if err != nil {
+        return
+    }
+    return srv.UploadImage(ctx, path, content)
+}
+
+// UploadVideoFile reads and uploads a local video
+func (srv *MediaService) UploadVideoFile(ctx context.Context, path string) (rsp *UploadResponse, err error) {
+    content, err := ioutil.ReadFile(path)
+    if err != nil {
+        return
+    }
+    return srv.UploadVideo(ctx, path, content)
+}
+
+func (srv *MediaService) upload(ctx context.Context, path, filename string, content []byte, exts []string, maxSize int) (
+    rsp *UploadResponse, err error) {
+    if err = client.ValidateMedia(filename, content, exts, maxSize); err != nil {
+        return
+    }
+    request, err := srv.Client.NewUploadRequest(ctx, path, filename, content)
+    if err != nil {
+        return
+    }
+    rsp = &UploadResponse{}
+    if err = srv.Client.Do(request, rsp); err != nil {
+        return
+    }
+    return
+}
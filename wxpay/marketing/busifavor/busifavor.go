@@ -0,0 +1,23 @@
+package busifavor
+
+import (
+    "context"
+
+    "github.com/yunlyz/go-wechat/wxpay/client"
+)
+
+// BusiFavor API V3文档-营销分类-商家券
+type BusiFavor struct {
+    Stock    *StockService
+    Coupon   *CouponService
+    Callback *CallbackService
+}
+
+func New(ctx context.Context, srv *client.Service) *BusiFavor {
+    busifavor := &BusiFavor{}
+    busifavor.Stock = (*StockService)(srv)
+    busifavor.Coupon = (*CouponService)(srv)
+    busifavor.Callback = (*CallbackService)(srv)
+
+    return busifavor
+}
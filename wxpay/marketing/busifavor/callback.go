@@ -0,0 +1,69 @@
+package busifavor
+
+import (
+    "context"
+    "errors"
+    "net/http"
+    "time"
+
+    "github.com/yunlyz/go-wechat/wxpay/client"
+)
+
+type CallbackService client.Service
+
+type SetCallbackRequest struct {
+    Mchid     string `json:"mchid,omitempty"`
+    NotifyURL string `json:"notify_url"`
+}
+
+type SetCallbackResponse struct {
+    UpdateTime time.Time `json:"update_time"`
+    NotifyURL  string    `json:"notify_url"`
+    Mchid      string    `json:"mchid"`
+}
+
+// SetCallback 设置商家券事件通知地址
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter9_2_7.shtml
+func (srv *CallbackService) SetCallback(ctx context.Context, req *SetCallbackRequest) (rsp *SetCallbackResponse, err error) {
+    request, err := srv.Client.NewRequest(ctx, http.MethodPost, "marketing/busifavor/callbacks", req)
+    if err != nil {
+        return
+    }
+    rsp = &SetCallbackResponse{}
+    if err = srv.Client.Do(request, rsp); err != nil {
+        return
+    }
+
+    return
+}
+
+type GetCallbackOptions struct {
+    Mchid string `url:"mchid"`
+}
+
+type GetCallbackResponse struct {
+    NotifyURL string `json:"notify_url"`
+    Mchid     string `json:"mchid"`
+}
+
+// GetCallback 查询商家券事件通知地址
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter9_2_8.shtml
+func (srv *CallbackService) GetCallback(ctx context.Context, mchid string) (rsp *GetCallbackResponse, err error) {
+    if mchid == "" {
+        return nil, errors.New("wxpay: mchid is required")
+    }
+    rawurl, err := client.AddOptions("marketing/busifavor/callbacks", &GetCallbackOptions{Mchid: mchid})
+    if err != nil {
+        return
+    }
+    request, err := srv.Client.NewRequest(ctx, http.MethodGet, rawurl, nil)
+    if err != nil {
+        return
+    }
+    rsp = &GetCallbackResponse{}
+    if err = srv.Client.Do(request, rsp); err != nil {
+        return
+    }
+
+    return
+}
@@ -0,0 +1,280 @@
+package busifavor
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "time"
+
+    "github.com/yunlyz/go-wechat/goutil"
+    "github.com/yunlyz/go-wechat/wxpay/client"
+)
+
+type CouponService client.Service
+
+// CouponState 券状态
+type CouponState string
+
+const (
+    CouponStateSended      CouponState = "SENDED"
+    CouponStateUsed        CouponState = "USED"
+    CouponStateExpired     CouponState = "EXPIRED"
+    CouponStateDeleted     CouponState = "DELETED"
+    CouponStateDeactivated CouponState = "DEACTIVATED"
+)
+
+// Coupon represents a business coupon of a user
+type Coupon struct {
+    BelongMerchant     string              `json:"belong_merchant"`
+    StockName          string              `json:"stock_name"`
+    Comment            string              `json:"comment"`
+    GoodsName          string              `json:"goods_name"`
+    StockType          string              `json:"stock_type"`
+    Transferable       bool                `json:"transferable"`
+    Shareable          bool                `json:"shareable"`
+    CouponState        CouponState         `json:"coupon_state"`
+    DisplayPatternInfo *DisplayPatternInfo `json:"display_pattern_info"`
+    CouponUseRule      *CouponUseRule      `json:"coupon_use_rule"`
+    CustomEntrance     *CustomEntrance     `json:"custom_entrance"`
+    CouponCode         string              `json:"coupon_code"`
+    StockID            string              `json:"stock_id"`
+    AvailableStartTime time.Time           `json:"available_start_time"`
+    ExpireTime         time.Time           `json:"expire_time"`
+    ReceiveTime        time.Time           `json:"receive_time"`
+    SendRequestNo      string              `json:"send_request_no"`
+    UseRequestNo       string              `json:"use_request_no"`
+    UseTime            *time.Time          `json:"use_time,omitempty"`
+}
+
+func (coupon *Coupon) String() string {
+    return goutil.Jsonify(coupon)
+}
+
+const maxUserCouponsLimit = 50
+
+type ListUserCouponsOptions struct {
+    Appid           string      `url:"appid"`
+    StockID         string      `url:"stock_id,omitempty"`
+    CouponState     CouponState `url:"coupon_state,omitempty"`
+    CreatorMerchant string      `url:"creator_merchant,omitempty"`
+    BelongMerchant  string      `url:"belong_merchant,omitempty"`
+    SenderMerchant  string      `url:"sender_merchant,omitempty"`
+    // Offset 分页页码，从0开始
+    Offset uint32 `url:"offset"`
+    Limit  uint32 `url:"limit"`
+}
+
+type ListUserCouponsResponse struct {
+    Data       []*Coupon `json:"data"`
+    TotalCount int       `json:"total_count"`
+    Limit      int       `json:"limit"`
+    Offset     int       `json:"offset"`
+}
+
+// ListUserCoupons 根据过滤条件查询用户券
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter9_2_4.shtml
+func (srv *CouponService) ListUserCoupons(ctx context.Context, openid string, opts *ListUserCouponsOptions) (
+    rsp *ListUserCouponsResponse, err error) {
+    if opts == nil || opts.Appid == "" {
+        return nil, errors.New("wxpay: appid is required")
+    }
+    query := *opts
+    if query.Limit == 0 {
+        query.Limit = maxUserCouponsLimit
+    }
+    if query.Limit > maxUserCouponsLimit {
+        return nil, fmt.Errorf("wxpay: limit %d exceeds %d", query.Limit, maxUserCouponsLimit)
+    }
+    path := fmt.Sprintf("marketing/busifavor/users/%s/coupons", openid)
+    rawurl, err := client.AddOptions(path, &query)
+    if err != nil {
+        return
+    }
+    request, err := srv.Client.NewRequest(ctx, http.MethodGet, rawurl, nil)
+    if err != nil {
+        return
+    }
+    rsp = &ListUserCouponsResponse{}
+    if err = srv.Client.Do(request, rsp); err != nil {
+        return
+    }
+
+    return
+}
+
+// CouponIterator iterates the pages of ListUserCoupons
+type CouponIterator struct {
+    *client.Iterator
+    coupons []*Coupon
+}
+
+// Coupons returns the coupons of the current page
+func (it *CouponIterator) Coupons() []*Coupon {
+    return it.coupons
+}
+
+// All reads the remaining pages
+func (it *CouponIterator) All(ctx context.Context) (coupons []*Coupon, err error) {
+    for it.Next(ctx) {
+        coupons = append(coupons, it.coupons...)
+    }
+    return coupons, it.Err()
+}
+
+// IterateUserCoupons walks ListUserCoupons page by page
+func (srv *CouponService) IterateUserCoupons(openid string, opts *ListUserCouponsOptions) *CouponIterator {
+    query := ListUserCouponsOptions{}
+    if opts != nil {
+        query = *opts
+    }
+    it := &CouponIterator{}
+    it.Iterator = client.NewIterator(int(query.Limit), func(ctx context.Context, offset, limit int) (n, total int, err error) {
+        query.Offset = uint32(offset)
+        query.Limit = uint32(limit)
+        result, err := srv.ListUserCoupons(ctx, openid, &query)
+        if err != nil {
+            return
+        }
+        it.coupons = result.Data
+        return len(result.Data), result.TotalCount, nil
+    })
+    it.PageNumbered = true
+    return it
+}
+
+// Get 查询用户单张券详情
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter9_2_5.shtml
+func (srv *CouponService) Get(ctx context.Context, appid, couponCode, openid string) (rsp *Coupon, err error) {
+    path := fmt.Sprintf("marketing/busifavor/users/%s/coupons/%s/appids/%s", openid, couponCode, appid)
+    request, err := srv.Client.NewRequest(ctx, http.MethodGet, path, nil)
+    if err != nil {
+        return
+    }
+    rsp = &Coupon{}
+    if err = srv.Client.Do(request, rsp); err != nil {
+        return
+    }
+
+    return
+}
+
+type UseCouponRequest struct {
+    CouponCode   string    `json:"coupon_code"`
+    StockID      string    `json:"stock_id,omitempty"`
+    Appid        string    `json:"appid"`
+    UseTime      time.Time `json:"use_time"`
+    UseRequestNo string    `json:"use_request_no"`
+    Openid       string    `json:"openid,omitempty"`
+}
+
+type UseCouponResponse struct {
+    StockID          string    `json:"stock_id"`
+    Openid           string    `json:"openid"`
+    WechatpayUseTime time.Time `json:"wechatpay_use_time"`
+}
+
+// Use 核销用户券
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter9_2_3.shtml
+// UseRequestNo为幂等单号，重试时保持不变
+func (srv *CouponService) Use(ctx context.Context, req *UseCouponRequest) (rsp *UseCouponResponse, err error) {
+    if req.UseRequestNo == "" {
+        return nil, errors.New("wxpay: use_request_no is required")
+    }
+    body := *req
+    if body.UseTime.IsZero() {
+        body.UseTime = time.Now()
+    }
+    rsp = &UseCouponResponse{}
+    err = srv.post(ctx, "marketing/busifavor/coupons/use", &body, rsp)
+    return
+}
+
+type AssociateRequest struct {
+    CouponCode   string `json:"coupon_code"`
+    OutTradeNo   string `json:"out_trade_no"`
+    StockID      string `json:"stock_id"`
+    OutRequestNo string `json:"out_request_no"`
+}
+
+type AssociateResponse struct {
+    WechatpayAssociateTime time.Time `json:"wechatpay_associate_time"`
+}
+
+// Associate 关联订单信息，将券与商户订单号关联用于对账
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter9_2_9.shtml
+func (srv *CouponService) Associate(ctx context.Context, req *AssociateRequest) (rsp *AssociateResponse, err error) {
+    if req.OutRequestNo == "" {
+        return nil, errors.New("wxpay: out_request_no is required")
+    }
+    rsp = &AssociateResponse{}
+    err = srv.post(ctx, "marketing/busifavor/coupons/associate", req, rsp)
+    return
+}
+
+type DisassociateResponse struct {
+    WechatpayDisassociateTime time.Time `json:"wechatpay_disassociate_time"`
+}
+
+// Disassociate 取消关联订单信息
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter9_2_10.shtml
+func (srv *CouponService) Disassociate(ctx context.Context, req *AssociateRequest) (rsp *DisassociateResponse, err error) {
+    if req.OutRequestNo == "" {
+        return nil, errors.New("wxpay: out_request_no is required")
+    }
+    rsp = &DisassociateResponse{}
+    err = srv.post(ctx, "marketing/busifavor/coupons/disassociate", req, rsp)
+    return
+}
+
+type ReturnCouponRequest struct {
+    CouponCode      string `json:"coupon_code"`
+    StockID         string `json:"stock_id"`
+    ReturnRequestNo string `json:"return_request_no"`
+}
+
+type ReturnCouponResponse struct {
+    WechatpayReturnTime time.Time `json:"wechatpay_return_time"`
+}
+
+// Return 申请退券，已核销的券退回后用户可再次使用
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter9_2_13.shtml
+func (srv *CouponService) Return(ctx context.Context, req *ReturnCouponRequest) (rsp *ReturnCouponResponse, err error) {
+    if req.ReturnRequestNo == "" {
+        return nil, errors.New("wxpay: return_request_no is required")
+    }
+    rsp = &ReturnCouponResponse{}
+    err = srv.post(ctx, "marketing/busifavor/coupons/return", req, rsp)
+    return
+}
+
+type DeactivateCouponRequest struct {
+    CouponCode          string `json:"coupon_code"`
+    StockID             string `json:"stock_id"`
+    DeactivateRequestNo string `json:"deactivate_request_no"`
+    DeactivateReason    string `json:"deactivate_reason,omitempty"`
+}
+
+type DeactivateCouponResponse struct {
+    WechatpayDeactivateTime time.Time `json:"wechatpay_deactivate_time"`
+}
+
+// Deactivate 使券失效，失效后不可恢复
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter9_2_14.shtml
+func (srv *CouponService) Deactivate(ctx context.Context, req *DeactivateCouponRequest) (rsp *DeactivateCouponResponse, err error) {
+    if req.DeactivateRequestNo == "" {
+        return nil, errors.New("wxpay: deactivate_request_no is required")
+    }
+    rsp = &DeactivateCouponResponse{}
+    err = srv.post(ctx, "marketing/busifavor/coupons/deactivate", req, rsp)
+    return
+}
+
+// post sends the coupon operations, each carrying its own request no, so they are safe to retry
+func (srv *CouponService) post(ctx context.Context, path string, req, rsp interface{}) (err error) {
+    request, err := srv.Client.NewRequest(client.WithIdempotent(ctx), http.MethodPost, path, req)
+    if err != nil {
+        return
+    }
+    return srv.Client.Do(request, rsp)
+}
@@ -0,0 +1,39 @@
+package busifavor
+
+import (
+    "context"
+    "testing"
+)
+
+func TestCouponOperationsRequireRequestNo(t *testing.T) {
+    srv := &CouponService{}
+    ctx := context.Background()
+    calls := map[string]func() error{
+        "Use": func() error {
+            _, err := srv.Use(ctx, &UseCouponRequest{CouponCode: "code"})
+            return err
+        },
+        "Associate": func() error {
+            _, err := srv.Associate(ctx, &AssociateRequest{CouponCode: "code", OutTradeNo: "trade"})
+            return err
+        },
+        "Disassociate": func() error {
+            _, err := srv.Disassociate(ctx, &AssociateRequest{CouponCode: "code", OutTradeNo: "trade"})
+            return err
+        },
+        "Return": func() error {
+            _, err := srv.Return(ctx, &ReturnCouponRequest{CouponCode: "code"})
+            return err
+        },
+        "Deactivate": func() error {
+            _, err := srv.Deactivate(ctx, &DeactivateCouponRequest{CouponCode: "code"})
+            return err
+        },
+    }
+    // the service has no client, the request no is checked before sending
+    for name, call := range calls {
+        if err := call(); err == nil {
+            t.Errorf("%s accepts a request without request no", name)
+        }
+    }
+}
@@ -0,0 +1,119 @@
+package busifavor
+
+import (
+    "crypto/hmac"
+    "crypto/sha256"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// 小程序发券插件单次最多发放的券数
+const maxSendCoupons = 10
+
+// SendCouponParam 单张券的发券参数
+type SendCouponParam struct {
+    StockID      string `json:"stock_id"`
+    OutRequestNo string `json:"out_request_no"`
+    // CouponCode 券code模式为MERCHANT_API时必填
+    CouponCode string `json:"coupon_code,omitempty"`
+}
+
+// SendCoupon 小程序发券插件或H5发券的参数，由后端签名后交给前端直接使用
+type SendCoupon struct {
+    SendCouponParams   []*SendCouponParam `json:"send_coupon_params"`
+    SendCouponMerchant string             `json:"send_coupon_merchant"`
+    // OpenID H5发券时必填
+    OpenID string `json:"open_id,omitempty"`
+    Sign   string `json:"sign"`
+}
+
+// Values flattens the parameters covered by the sign, the n-th coupon becomes
+// stock_id{n}, out_request_no{n} and coupon_code{n}
+func (send *SendCoupon) Values() map[string]string {
+    values := map[string]string{
+        "send_coupon_merchant": send.SendCouponMerchant,
+        "open_id":              send.OpenID,
+    }
+    for i, param := range send.SendCouponParams {
+        n := strconv.Itoa(i)
+        values["stock_id"+n] = param.StockID
+        values["out_request_no"+n] = param.OutRequestNo
+        values["coupon_code"+n] = param.CouponCode
+    }
+    return values
+}
+
+// SignWith validates the parameters and signs them with the merchant API key
+func (send *SendCoupon) SignWith(apiKey string) error {
+    if apiKey == "" {
+        return errors.New("wxpay: api key is required")
+    }
+    if send.SendCouponMerchant == "" {
+        return errors.New("wxpay: send_coupon_merchant is required")
+    }
+    if n := len(send.SendCouponParams); n == 0 || n > maxSendCoupons {
+        return fmt.Errorf("wxpay: send_coupon_params must have 1 to %d coupons", maxSendCoupons)
+    }
+    for i, param := range send.SendCouponParams {
+        if param.StockID == "" || param.OutRequestNo == "" {
+            return fmt.Errorf("wxpay: stock_id%d and out_request_no%d are required", i, i)
+        }
+    }
+    send.Sign = Sign(apiKey, send.Values())
+    return nil
+}
+
+// Sign 发券签名：参数按key的ASCII码升序以key=value&拼接，空值不参与签名，
+// 末尾拼接&key=apiKey后以apiKey为密钥计算HMAC-SHA256，结果转为大写
+func Sign(apiKey string, values map[string]string) string {
+    keys := make([]string, 0, len(values))
+    for k, v := range values {
+        if v != "" && k != "sign" {
+            keys = append(keys, k)
+        }
+    }
+    sort.Strings(keys)
+
+    var buf strings.Builder
+    for _, k := range keys {
+        buf.WriteString(k)
+        buf.WriteByte('=')
+        buf.WriteString(values[k])
+        buf.WriteByte('&')
+    }
+    buf.WriteString("key=")
+    buf.WriteString(apiKey)
+
+    mac := hmac.New(sha256.New, []byte(apiKey))
+    mac.Write([]byte(buf.String()))
+    return strings.ToUpper(hex.EncodeToString(mac.Sum(nil)))
+}
+
+// NewSendCoupons splits the coupons into signed batches of at most 10,
+// openid is only set for H5 sends
+func NewSendCoupons(apiKey, merchant, openid string, params []*SendCouponParam) (sends []*SendCoupon, err error) {
+    if len(params) == 0 {
+        return nil, errors.New("wxpay: no coupon to send")
+    }
+    for len(params) > 0 {
+        n := len(params)
+        if n > maxSendCoupons {
+            n = maxSendCoupons
+        }
+        send := &SendCoupon{
+            SendCouponParams:   params[:n],
+            SendCouponMerchant: merchant,
+            OpenID:             openid,
+        }
+        if err = send.SignWith(apiKey); err != nil {
+            return nil, err
+        }
+        sends = append(sends, send)
+        params = params[n:]
+    }
+    return
+}
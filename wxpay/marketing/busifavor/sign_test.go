@@ -0,0 +1,54 @@
+package busifavor
+
+import (
+    "testing"
+)
+
+// testSign is HMAC-SHA256 of the documented string format, computed apart with
+// openssl dgst -sha256 -hmac over
+// out_request_no0=abc123&send_coupon_merchant=10016226&stock_id0=1234567&key=192006250b4c09247ec02edce69f6a2d
+const (
+    testAPIKey = "192006250b4c09247ec02edce69f6a2d"
+    testSign   = "AD7CD2967446E742075BF7A52CEBC5FE1A17A4042ED451A44DAABF9F04FFDD99"
+)
+
+func TestSign(t *testing.T) {
+    values := map[string]string{
+        "stock_id0":            "1234567",
+        "out_request_no0":      "abc123",
+        "send_coupon_merchant": "10016226",
+        // empty values and the sign itself are left out
+        "coupon_code0": "",
+        "open_id":      "",
+        "sign":         "0000",
+    }
+    if sign := Sign(testAPIKey, values); sign != testSign {
+        t.Fatalf("sign %s, want %s", sign, testSign)
+    }
+}
+
+func TestNewSendCoupons(t *testing.T) {
+    params := make([]*SendCouponParam, 11)
+    for i := range params {
+        params[i] = &SendCouponParam{StockID: "1234567", OutRequestNo: "abc123"}
+    }
+    sends, err := NewSendCoupons(testAPIKey, "10016226", "", params)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(sends) != 2 || len(sends[0].SendCouponParams) != 10 || len(sends[1].SendCouponParams) != 1 {
+        t.Fatalf("got %d batches, want 10 coupons and 1", len(sends))
+    }
+    // the last batch holds the single coupon of testSign
+    if sends[1].Sign != testSign {
+        t.Fatalf("sign %s, want %s", sends[1].Sign, testSign)
+    }
+
+    if _, err = NewSendCoupons(testAPIKey, "10016226", "", nil); err == nil {
+        t.Fatal("no coupon is accepted")
+    }
+    params[3].OutRequestNo = ""
+    if _, err = NewSendCoupons(testAPIKey, "10016226", "", params); err == nil {
+        t.Fatal("a coupon without out_request_no is accepted")
+    }
+}
@@ -0,0 +1,342 @@
+package busifavor
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "time"
+
+    "github.com/yunlyz/go-wechat/goutil"
+    "github.com/yunlyz/go-wechat/wxpay/client"
+)
+
+type StockService client.Service
+
+// 批次类型
+const (
+    StockTypeNormal   = "NORMAL"
+    StockTypeDiscount = "DISCOUNT"
+    StockTypeExchange = "EXCHANGE"
+)
+
+// 核销方式
+const (
+    UseMethodOffLine      = "OFF_LINE"
+    UseMethodMiniPrograms = "MINI_PROGRAMS"
+    UseMethodSelfConsume  = "SELF_CONSUME"
+    UseMethodPaymentCode  = "PAYMENT_CODE"
+)
+
+// 券code模式
+const (
+    CouponCodeModeWechatpay      = "WECHATPAY_MODE"
+    CouponCodeModeMerchantAPI    = "MERCHANT_API"
+    CouponCodeModeMerchantUpload = "MERCHANT_UPLOAD"
+)
+
+// StockState 批次状态
+type StockState string
+
+const (
+    StockStateUnaudit StockState = "UNAUDIT"
+    StockStateRunning StockState = "RUNNING"
+    StockStateStoped  StockState = "STOPED"
+    StockStatePaused  StockState = "PAUSED"
+)
+
+// CouponUseRule 核销规则
+type CouponUseRule struct {
+    CouponAvailableTime *CouponAvailableTime `json:"coupon_available_time,omitempty"`
+    FixedNormalCoupon   *FixedNormalCoupon   `json:"fixed_normal_coupon,omitempty"`
+    DiscountCoupon      *DiscountCoupon      `json:"discount_coupon,omitempty"`
+    ExchangeCoupon      *ExchangeCoupon      `json:"exchange_coupon,omitempty"`
+    UseMethod           string               `json:"use_method,omitempty"`
+    MiniProgramsAppid   string               `json:"mini_programs_appid,omitempty"`
+    MiniProgramsPath    string               `json:"mini_programs_path,omitempty"`
+}
+
+// CouponAvailableTime 券可核销时间
+type CouponAvailableTime struct {
+    AvailableBeginTime time.Time `json:"available_begin_time"`
+    AvailableEndTime   time.Time `json:"available_end_time"`
+    // AvailableDayAfterReceive 领取后N天内有效
+    AvailableDayAfterReceive int `json:"available_day_after_receive,omitempty"`
+    AvailableWeek            *struct {
+        WeekDay []int `json:"week_day,omitempty"`
+        // AvailableDayTime 当天可用时间段，单位秒
+        AvailableDayTime []*struct {
+            BeginTime int `json:"begin_time"`
+            EndTime   int `json:"end_time"`
+        } `json:"available_day_time,omitempty"`
+    } `json:"available_week,omitempty"`
+    IrregularyAvaliableTime []*struct {
+        BeginTime time.Time `json:"begin_time"`
+        EndTime   time.Time `json:"end_time"`
+    } `json:"irregulary_avaliable_time,omitempty"`
+}
+
+// FixedNormalCoupon 固定面额满减券
+type FixedNormalCoupon struct {
+    DiscountAmount     int64 `json:"discount_amount"`
+    TransactionMinimum int64 `json:"transaction_minimum"`
+}
+
+// DiscountCoupon 折扣券
+type DiscountCoupon struct {
+    // DiscountPercent 折扣百分比，88表示8.8折
+    DiscountPercent    int   `json:"discount_percent"`
+    TransactionMinimum int64 `json:"transaction_minimum"`
+}
+
+// ExchangeCoupon 换购券
+type ExchangeCoupon struct {
+    ExchangePrice      int64 `json:"exchange_price"`
+    TransactionMinimum int64 `json:"transaction_minimum"`
+}
+
+// StockSendRule 发放规则
+type StockSendRule struct {
+    MaxAmount          int64 `json:"max_amount,omitempty"`
+    MaxCoupons         int64 `json:"max_coupons,omitempty"`
+    MaxCouponsPerUser  int   `json:"max_coupons_per_user,omitempty"`
+    MaxAmountByDay     int64 `json:"max_amount_by_day,omitempty"`
+    MaxCouponsByDay    int64 `json:"max_coupons_by_day,omitempty"`
+    NaturalPersonLimit bool  `json:"natural_person_limit"`
+    PreventAPIAbuse    bool  `json:"prevent_api_abuse"`
+    Transferable       bool  `json:"transferable"`
+    Shareable          bool  `json:"shareable"`
+}
+
+// CustomEntrance 自定义入口
+type CustomEntrance struct {
+    MiniProgramsInfo *struct {
+        MiniProgramsAppid string `json:"mini_programs_appid"`
+        MiniProgramsPath  string `json:"mini_programs_path"`
+        EntranceWords     string `json:"entrance_words"`
+        GuidingWords      string `json:"guiding_words,omitempty"`
+    } `json:"mini_programs_info,omitempty"`
+    Appid           string `json:"appid,omitempty"`
+    HallID          string `json:"hall_id,omitempty"`
+    StoreID         string `json:"store_id,omitempty"`
+    CodeDisplayMode string `json:"code_display_mode,omitempty"`
+}
+
+// DisplayPatternInfo 样式信息
+type DisplayPatternInfo struct {
+    Description     string `json:"description,omitempty"`
+    MerchantLogoURL string `json:"merchant_logo_url,omitempty"`
+    MerchantName    string `json:"merchant_name,omitempty"`
+    BackgroundColor string `json:"background_color,omitempty"`
+    // CouponImageURL 券详情图片，使用favor.MediaService.UploadImage返回的media_url
+    CouponImageURL string `json:"coupon_image_url,omitempty"`
+}
+
+// NotifyConfig 事件通知配置
+type NotifyConfig struct {
+    NotifyAppid string `json:"notify_appid,omitempty"`
+}
+
+// CreateStockRequest 创建商家券请求
+type CreateStockRequest struct {
+    StockName          string              `json:"stock_name"`
+    BelongMerchant     string              `json:"belong_merchant"`
+    Comment            string              `json:"comment,omitempty"`
+    GoodsName          string              `json:"goods_name"`
+    StockType          string              `json:"stock_type"`
+    CouponUseRule      *CouponUseRule      `json:"coupon_use_rule"`
+    StockSendRule      *StockSendRule      `json:"stock_send_rule"`
+    OutRequestNo       string              `json:"out_request_no"`
+    CustomEntrance     *CustomEntrance     `json:"custom_entrance,omitempty"`
+    DisplayPatternInfo *DisplayPatternInfo `json:"display_pattern_info,omitempty"`
+    CouponCodeMode     string              `json:"coupon_code_mode"`
+    NotifyConfig       *NotifyConfig       `json:"notify_config,omitempty"`
+}
+
+type CreateStockResponse struct {
+    StockID    string    `json:"stock_id"`
+    CreateTime time.Time `json:"create_time"`
+}
+
+// CreateStock 创建商家券
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter9_2_1.shtml
+func (srv *StockService) CreateStock(ctx context.Context, req *CreateStockRequest) (rsp *CreateStockResponse, err error) {
+    if req.OutRequestNo == "" {
+        return nil, errors.New("wxpay: out_request_no is required")
+    }
+    request, err := srv.Client.NewRequest(ctx, http.MethodPost, "marketing/busifavor/stocks", req)
+    if err != nil {
+        return
+    }
+    rsp = &CreateStockResponse{}
+    if err = srv.Client.Do(request, rsp); err != nil {
+        return
+    }
+
+    return
+}
+
+// Stock represents a business coupon stock
+type Stock struct {
+    StockID            string              `json:"stock_id"`
+    StockName          string              `json:"stock_name"`
+    BelongMerchant     string              `json:"belong_merchant"`
+    Comment            string              `json:"comment"`
+    GoodsName          string              `json:"goods_name"`
+    StockType          string              `json:"stock_type"`
+    CouponUseRule      *CouponUseRule      `json:"coupon_use_rule"`
+    StockSendRule      *StockSendRule      `json:"stock_send_rule"`
+    CustomEntrance     *CustomEntrance     `json:"custom_entrance"`
+    DisplayPatternInfo *DisplayPatternInfo `json:"display_pattern_info"`
+    StockState         StockState          `json:"stock_state"`
+    CouponCodeMode     string              `json:"coupon_code_mode"`
+    CouponCodeCount    *struct {
+        TotalCount     int64 `json:"total_count"`
+        AvailableCount int64 `json:"available_count"`
+    } `json:"coupon_code_count"`
+    NotifyConfig         *NotifyConfig `json:"notify_config"`
+    SendCountInformation *struct {
+        TotalSendNum    int64 `json:"total_send_num"`
+        TotalSendAmount int64 `json:"total_send_amount"`
+        TodaySendNum    int64 `json:"today_send_num"`
+        TodaySendAmount int64 `json:"today_send_amount"`
+    } `json:"send_count_information"`
+}
+
+func (stock *Stock) String() string {
+    return goutil.Jsonify(stock)
+}
+
+// GetStock 查询商家券详情
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter9_2_2.shtml
+func (srv *StockService) GetStock(ctx context.Context, stockID string) (rsp *Stock, err error) {
+    path := fmt.Sprintf("marketing/busifavor/stocks/%s", stockID)
+    request, err := srv.Client.NewRequest(ctx, http.MethodGet, path, nil)
+    if err != nil {
+        return
+    }
+    rsp = &Stock{}
+    if err = srv.Client.Do(request, rsp); err != nil {
+        return
+    }
+
+    return
+}
+
+// ModifyStockRequest 修改商家券基本信息，只发送需要修改的字段
+type ModifyStockRequest struct {
+    CustomEntrance     *CustomEntrance     `json:"custom_entrance,omitempty"`
+    StockName          string              `json:"stock_name,omitempty"`
+    Comment            string              `json:"comment,omitempty"`
+    GoodsName          string              `json:"goods_name,omitempty"`
+    OutRequestNo       string              `json:"out_request_no"`
+    DisplayPatternInfo *DisplayPatternInfo `json:"display_pattern_info,omitempty"`
+    CouponUseRule      *struct {
+        UseMethod         string `json:"use_method,omitempty"`
+        MiniProgramsAppid string `json:"mini_programs_appid,omitempty"`
+        MiniProgramsPath  string `json:"mini_programs_path,omitempty"`
+    } `json:"coupon_use_rule,omitempty"`
+    StockSendRule *struct {
+        PreventAPIAbuse    bool `json:"prevent_api_abuse"`
+        NaturalPersonLimit bool `json:"natural_person_limit"`
+    } `json:"stock_send_rule,omitempty"`
+    NotifyConfig *NotifyConfig `json:"notify_config,omitempty"`
+}
+
+// ModifyStock 修改商家券基本信息，成功时无应答内容
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter9_2_12.shtml
+func (srv *StockService) ModifyStock(ctx context.Context, stockID string, req *ModifyStockRequest) (err error) {
+    if req.OutRequestNo == "" {
+        return errors.New("wxpay: out_request_no is required")
+    }
+    path := fmt.Sprintf("marketing/busifavor/stocks/%s", stockID)
+    request, err := srv.Client.NewRequest(ctx, http.MethodPatch, path, req)
+    if err != nil {
+        return
+    }
+
+    return srv.Client.Do(request, nil)
+}
+
+type ModifyStockBudgetRequest struct {
+    TargetMaxCoupons       int64  `json:"target_max_coupons,omitempty"`
+    CurrentMaxCoupons      int64  `json:"current_max_coupons,omitempty"`
+    TargetMaxCouponsByDay  int64  `json:"target_max_coupons_by_day,omitempty"`
+    CurrentMaxCouponsByDay int64  `json:"current_max_coupons_by_day,omitempty"`
+    ModifyBudgetRequestNo  string `json:"modify_budget_request_no"`
+}
+
+type ModifyStockBudgetResponse struct {
+    MaxCoupons      int64 `json:"max_coupons"`
+    MaxCouponsByDay int64 `json:"max_coupons_by_day"`
+}
+
+// ModifyStockBudget 修改批次预算
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter9_2_11.shtml
+// CurrentMaxCoupons为修改前的值用于并发校验，ModifyBudgetRequestNo为幂等单号
+func (srv *StockService) ModifyStockBudget(ctx context.Context, stockID string, req *ModifyStockBudgetRequest) (
+    rsp *ModifyStockBudgetResponse, err error) {
+    if req.TargetMaxCoupons == 0 && req.TargetMaxCouponsByDay == 0 {
+        return nil, errors.New("wxpay: one of target_max_coupons and target_max_coupons_by_day is required")
+    }
+    if req.ModifyBudgetRequestNo == "" {
+        return nil, errors.New("wxpay: modify_budget_request_no is required")
+    }
+    path := fmt.Sprintf("marketing/busifavor/stocks/%s/budget", stockID)
+    request, err := srv.Client.NewRequest(ctx, http.MethodPatch, path, req)
+    if err != nil {
+        return
+    }
+    rsp = &ModifyStockBudgetResponse{}
+    if err = srv.Client.Do(request, rsp); err != nil {
+        return
+    }
+
+    return
+}
+
+const maxUploadCouponCodes = 200
+
+type UploadCouponCodesRequest struct {
+    CouponCodeList  []string `json:"coupon_code_list"`
+    UploadRequestNo string   `json:"upload_request_no"`
+}
+
+type UploadCouponCodesResponse struct {
+    StockID      string    `json:"stock_id"`
+    TotalCount   int64     `json:"total_count"`
+    SuccessCount int64     `json:"success_count"`
+    SuccessCodes []string  `json:"success_codes"`
+    SuccessTime  time.Time `json:"success_time"`
+    FailCount    int64     `json:"fail_count"`
+    FailCodes    []*struct {
+        CouponCode string `json:"coupon_code"`
+        Code       string `json:"code"`
+        Message    string `json:"message"`
+    } `json:"fail_codes"`
+    ExistCodes     []string `json:"exist_codes"`
+    DuplicateCodes []string `json:"duplicate_codes"`
+}
+
+// UploadCouponCodes 上传预存code，券code模式为MERCHANT_UPLOAD的批次使用，单次最多200个
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter9_2_6.shtml
+func (srv *StockService) UploadCouponCodes(ctx context.Context, stockID string, req *UploadCouponCodesRequest) (
+    rsp *UploadCouponCodesResponse, err error) {
+    if n := len(req.CouponCodeList); n == 0 || n > maxUploadCouponCodes {
+        return nil, fmt.Errorf("wxpay: coupon_code_list must have 1 to %d codes", maxUploadCouponCodes)
+    }
+    if req.UploadRequestNo == "" {
+        return nil, errors.New("wxpay: upload_request_no is required")
+    }
+    path := fmt.Sprintf("marketing/busifavor/stocks/%s/couponcodes", stockID)
+    request, err := srv.Client.NewRequest(client.WithIdempotent(ctx), http.MethodPost, path, req)
+    if err != nil {
+        return
+    }
+    rsp = &UploadCouponCodesResponse{}
+    if err = srv.Client.Do(request, rsp); err != nil {
+        return
+    }
+
+    return
+}
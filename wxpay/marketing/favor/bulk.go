@@ -0,0 +1,271 @@
+package favor
+
+import (
+    "bufio"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "sync"
+    "time"
+
+    "github.com/yunlyz/go-wechat/wxpay/client"
+)
+
+// 发券结果
+const (
+    OutcomeSuccess = "SUCCESS"
+    // OutcomeError 网络错误等无错误码的失败
+    OutcomeError = "ERROR"
+)
+
+// ErrStockExhausted is returned by BulkSender.Send when the stock runs out of budget,
+// the recipients not yet sent are left for a later resume
+var ErrStockExhausted = errors.New("wxpay: stock budget exhausted")
+
+// BulkOptions configures a BulkSender
+type BulkOptions struct {
+    // Workers 并发数，默认10
+    Workers int
+    // Rate 每秒请求数上限，0不限制
+    Rate int
+    // Checkpoint 进度文件，已有最终结果的openid在恢复时跳过
+    Checkpoint string
+    // OnResult 每个收件人的结果，在单个goroutine中调用
+    OnResult func(result *BulkResult)
+}
+
+// BulkResult is the outcome of sending a coupon to one openid
+type BulkResult struct {
+    OpenID       string `json:"openid"`
+    OutRequestNo string `json:"out_request_no"`
+    CouponID     string `json:"coupon_id,omitempty"`
+    // Outcome OutcomeSuccess，OutcomeError或者错误码，如USER_ACCOUNT_ABNORMAL、RULE_LIMIT
+    Outcome string `json:"outcome"`
+    Err     error  `json:"-"`
+}
+
+// final reports whether sending again cannot change the outcome, only the outcomes
+// specific to the recipient are, any other error may be fixed before resuming
+func (result *BulkResult) final() bool {
+    if result.Err == nil {
+        return true
+    }
+    apiErr, ok := client.AsAPIError(result.Err)
+    if !ok {
+        return false
+    }
+    switch apiErr.Code {
+    case client.CodeUserAccountAbnormal, client.CodeRuleLimit:
+        return true
+    }
+    return false
+}
+
+// BulkReport counts the outcomes of BulkSender.Send
+type BulkReport struct {
+    // Skipped 进度文件中已完成的openid
+    Skipped  int
+    Outcomes map[string]int
+}
+
+// BulkSender sends the coupons of a stock to many openids
+type BulkSender struct {
+    srv      *CouponService
+    template CreateCouponRequest
+    opts     BulkOptions
+}
+
+// BulkSender creates a sender issuing req to each recipient, req.OutRequestNo is ignored
+// and generated by OutRequestNo so that a coupon is sent at most once per openid
+func (srv *CouponService) BulkSender(req *CreateCouponRequest, opts *BulkOptions) *BulkSender {
+    sender := &BulkSender{srv: srv, template: *req}
+    if opts != nil {
+        sender.opts = *opts
+    }
+    if sender.opts.Workers <= 0 {
+        sender.opts.Workers = 10
+    }
+    return sender
+}
+
+// OutRequestNo 商户单据号，同一批次同一用户固定不变，重试时由微信支付去重
+func OutRequestNo(mchId int64, stockID, openid string) string {
+    sum := sha256.Sum256([]byte(stockID + "|" + openid))
+    return fmt.Sprintf("%d_%s", mchId, hex.EncodeToString(sum[:16]))
+}
+
+// Send issues a coupon to every openid read from openids until the channel is closed.
+// It stops with ErrStockExhausted on NOT_ENOUGH, resuming later with the same
+// Checkpoint sends only to the recipients without a final outcome.
+func (sender *BulkSender) Send(ctx context.Context, openids <-chan string) (report *BulkReport, err error) {
+    report = &BulkReport{Outcomes: map[string]int{}}
+
+    done, err := loadCheckpoint(sender.opts.Checkpoint)
+    if err != nil {
+        return
+    }
+    var checkpoint *os.File
+    if sender.opts.Checkpoint != "" {
+        checkpoint, err = os.OpenFile(sender.opts.Checkpoint, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+        if err != nil {
+            return
+        }
+        defer func() {
+            if e := checkpoint.Close(); err == nil {
+                err = e
+            }
+        }()
+    }
+
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    var tick <-chan time.Time
+    if sender.opts.Rate > 0 {
+        ticker := time.NewTicker(time.Second / time.Duration(sender.opts.Rate))
+        defer ticker.Stop()
+        tick = ticker.C
+    }
+
+    jobs := make(chan string)
+    results := make(chan *BulkResult)
+    var wg sync.WaitGroup
+    for i := 0; i < sender.opts.Workers; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for openid := range jobs {
+                if tick != nil {
+                    select {
+                    case <-tick:
+                    case <-ctx.Done():
+                        return
+                    }
+                }
+                results <- sender.send(ctx, openid)
+            }
+        }()
+    }
+
+    // the producer counts the skipped openids, it is waited for before reading report.Skipped
+    produced := make(chan struct{})
+    go func() {
+        defer close(produced)
+        defer close(jobs)
+        for {
+            select {
+            case openid, ok := <-openids:
+                if !ok {
+                    return
+                }
+                if _, ok = done[openid]; ok {
+                    report.Skipped++
+                    continue
+                }
+                select {
+                case jobs <- openid:
+                case <-ctx.Done():
+                    return
+                }
+            case <-ctx.Done():
+                return
+            }
+        }
+    }()
+
+    go func() {
+        wg.Wait()
+        close(results)
+    }()
+
+    var exhausted bool
+    for result := range results {
+        if ctx.Err() != nil && errors.Is(result.Err, context.Canceled) {
+            // interrupted, neither final nor worth reporting
+            continue
+        }
+        report.Outcomes[result.Outcome]++
+        if sender.opts.OnResult != nil {
+            sender.opts.OnResult(result)
+        }
+        if checkpoint != nil && result.final() && err == nil {
+            err = writeCheckpoint(checkpoint, result)
+            if err != nil {
+                cancel()
+            }
+        }
+        if client.IsNotEnough(result.Err) && !exhausted {
+            exhausted = true
+            cancel()
+        }
+    }
+
+    <-produced
+
+    if err != nil {
+        return
+    }
+    if exhausted {
+        return report, ErrStockExhausted
+    }
+    return report, ctx.Err()
+}
+
+func (sender *BulkSender) send(ctx context.Context, openid string) *BulkResult {
+    req := sender.template
+    req.OutRequestNo = OutRequestNo(sender.srv.Client.MchId, req.StockID, openid)
+    result := &BulkResult{OpenID: openid, OutRequestNo: req.OutRequestNo}
+
+    rsp, err := sender.srv.Create(ctx, openid, &req)
+    switch apiErr, ok := client.AsAPIError(err); {
+    case err == nil:
+        result.Outcome = OutcomeSuccess
+        result.CouponID = rsp.CouponID
+    case ok:
+        result.Outcome = apiErr.Code
+        result.Err = err
+    default:
+        result.Outcome = OutcomeError
+        result.Err = err
+    }
+    return result
+}
+
+// loadCheckpoint reads the openids with a final outcome, a line cut short by a crash is ignored
+func loadCheckpoint(name string) (done map[string]struct{}, err error) {
+    done = map[string]struct{}{}
+    if name == "" {
+        return
+    }
+    file, err := os.Open(name)
+    if os.IsNotExist(err) {
+        return done, nil
+    }
+    if err != nil {
+        return
+    }
+    defer file.Close()
+
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        result := &BulkResult{}
+        if json.Unmarshal(scanner.Bytes(), result) != nil || result.OpenID == "" {
+            continue
+        }
+        done[result.OpenID] = struct{}{}
+    }
+    return done, scanner.Err()
+}
+
+func writeCheckpoint(file *os.File, result *BulkResult) error {
+    line, err := json.Marshal(result)
+    if err != nil {
+        return err
+    }
+    _, err = file.Write(append(line, '\n'))
+    return err
+}
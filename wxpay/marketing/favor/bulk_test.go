@@ -0,0 +1,251 @@
+package favor
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "errors"
+    "io/ioutil"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/yunlyz/go-wechat/wxpay/client"
+)
+
+// acceptVerifier trusts every response of the fake server
+type acceptVerifier struct{}
+
+func (acceptVerifier) Verify(serialNo string, message []byte, signature string) error {
+    return nil
+}
+
+// couponServer issues coupons, the openids named after an error code fail with it
+type couponServer struct {
+    mu       sync.Mutex
+    requests map[string]int
+}
+
+func (s *couponServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    parts := strings.Split(r.URL.Path, "/")
+    openid := parts[len(parts)-2]
+    s.mu.Lock()
+    s.requests[openid]++
+    s.mu.Unlock()
+
+    w.Header().Set("Wechatpay-Timestamp", "0")
+    w.Header().Set("Content-Type", "application/json")
+    switch openid {
+    case client.CodeUserAccountAbnormal, client.CodeRuleLimit:
+        w.WriteHeader(http.StatusForbidden)
+        json.NewEncoder(w).Encode(&client.ErrorMessage{Code: openid, Message: "rejected"})
+    case client.CodeParamError:
+        w.WriteHeader(http.StatusBadRequest)
+        json.NewEncoder(w).Encode(&client.ErrorMessage{Code: openid, Message: "invalid"})
+    default:
+        json.NewEncoder(w).Encode(&CreateCouponResponse{CouponID: "coupon-" + openid})
+    }
+}
+
+func (s *couponServer) count(openid string) int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.requests[openid]
+}
+
+func newTestCouponService(t *testing.T, baseURL string) *CouponService {
+    signer := client.SignerFunc(func(ctx context.Context, message []byte) (string, string, error) {
+        return "c2lnbmF0dXJl", "serial", nil
+    })
+    c, err := client.NewClient(1900000001,
+        client.WithBaseURL(baseURL),
+        client.WithSigner(signer),
+        client.WithVerifier(acceptVerifier{}),
+        client.WithMaxClockSkew(-1),
+    )
+    if err != nil {
+        t.Fatal(err)
+    }
+    return &CouponService{Client: c}
+}
+
+func openidsOf(ids ...string) <-chan string {
+    ch := make(chan string, len(ids))
+    for _, id := range ids {
+        ch <- id
+    }
+    close(ch)
+    return ch
+}
+
+func TestBulkResultFinal(t *testing.T) {
+    tests := []struct {
+        err   error
+        final bool
+    }{
+        {nil, true},
+        {&client.APIError{ErrorMessage: client.ErrorMessage{Code: client.CodeUserAccountAbnormal}, StatusCode: 403}, true},
+        {&client.APIError{ErrorMessage: client.ErrorMessage{Code: client.CodeRuleLimit}, StatusCode: 403}, true},
+        {&client.APIError{ErrorMessage: client.ErrorMessage{Code: client.CodeParamError}, StatusCode: 400}, false},
+        {&client.APIError{ErrorMessage: client.ErrorMessage{Code: client.CodeNoAuth}, StatusCode: 403}, false},
+        {&client.APIError{ErrorMessage: client.ErrorMessage{Code: client.CodeSignError}, StatusCode: 401}, false},
+        {&client.APIError{ErrorMessage: client.ErrorMessage{Code: client.CodeResourceNotExists}, StatusCode: 404}, false},
+        {&client.APIError{ErrorMessage: client.ErrorMessage{Code: client.CodeNotEnough}, StatusCode: 403}, false},
+        {errors.New("connection reset"), false},
+    }
+    for _, tt := range tests {
+        if final := (&BulkResult{Err: tt.err}).final(); final != tt.final {
+            t.Errorf("final of %v = %v, want %v", tt.err, final, tt.final)
+        }
+    }
+}
+
+func TestBulkSendCancelAndResume(t *testing.T) {
+    srv := &couponServer{requests: map[string]int{}}
+    ts := httptest.NewServer(srv)
+    defer ts.Close()
+    coupons := newTestCouponService(t, ts.URL)
+
+    dir, err := ioutil.TempDir("", "bulk")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    checkpoint := filepath.Join(dir, "checkpoint")
+
+    recipients := []string{
+        client.CodeParamError, client.CodeUserAccountAbnormal, client.CodeRuleLimit,
+        "o1", "o2", "o3", "o4", "o5",
+    }
+    req := &CreateCouponRequest{StockID: "9856000", Appid: "wx233544546545989", StockCreatorMchid: "1900000001"}
+
+    // interrupted after the first four recipients
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    var received int
+    sender := coupons.BulkSender(req, &BulkOptions{
+        Workers:    1,
+        Rate:       100,
+        Checkpoint: checkpoint,
+        OnResult: func(result *BulkResult) {
+            if received++; received == 4 {
+                cancel()
+            }
+        },
+    })
+    report, err := sender.Send(ctx, openidsOf(recipients...))
+    if err != context.Canceled {
+        t.Fatalf("interrupted send: %v", err)
+    }
+    if report.Skipped != 0 || report.Outcomes[OutcomeSuccess] == 0 {
+        t.Fatalf("interrupted report %+v", report)
+    }
+    first := readCheckpoint(t, checkpoint)
+    if _, ok := first[client.CodeParamError]; ok {
+        t.Fatal("PARAM_ERROR is recorded as final")
+    }
+
+    // resumed, the final outcomes are skipped and the others sent again
+    sender = coupons.BulkSender(req, &BulkOptions{Workers: 3, Rate: 100, Checkpoint: checkpoint})
+    report, err = sender.Send(context.Background(), openidsOf(recipients...))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if report.Skipped != len(first) {
+        t.Fatalf("skipped %d, want the %d recipients of the checkpoint", report.Skipped, len(first))
+    }
+    if n := srv.count(client.CodeParamError); n != 2 {
+        t.Fatalf("PARAM_ERROR sent %d times, want again on resume", n)
+    }
+    for _, openid := range []string{client.CodeUserAccountAbnormal, client.CodeRuleLimit, "o1"} {
+        if n := srv.count(openid); n != 1 {
+            t.Fatalf("%s sent %d times, want once", openid, n)
+        }
+    }
+
+    final := readCheckpoint(t, checkpoint)
+    for _, openid := range recipients[1:] {
+        if final[openid] != 1 {
+            t.Fatalf("%s recorded %d times in the checkpoint", openid, final[openid])
+        }
+    }
+}
+
+// readCheckpoint counts the lines of each openid
+func readCheckpoint(t *testing.T, name string) map[string]int {
+    file, err := os.Open(name)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer file.Close()
+    lines := map[string]int{}
+    scanner := bufio.NewScanner(file)
+    for scanner.Scan() {
+        result := &BulkResult{}
+        if err = json.Unmarshal(scanner.Bytes(), result); err != nil {
+            t.Fatal(err)
+        }
+        lines[result.OpenID]++
+    }
+    return lines
+}
+
+func TestBulkSendCancelWhileSkipping(t *testing.T) {
+    ts := httptest.NewServer(&couponServer{requests: map[string]int{}})
+    defer ts.Close()
+    coupons := newTestCouponService(t, ts.URL)
+
+    dir, err := ioutil.TempDir("", "bulk")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    checkpoint := filepath.Join(dir, "checkpoint")
+
+    file, err := os.Create(checkpoint)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err = writeCheckpoint(file, &BulkResult{OpenID: "done", Outcome: OutcomeSuccess}); err != nil {
+        t.Fatal(err)
+    }
+    file.Close()
+
+    // the recipients already done keep coming after the one being rate limited
+    openids := make(chan string)
+    stop := make(chan struct{})
+    defer close(stop)
+    go func() {
+        openids <- "pending"
+        for {
+            select {
+            case openids <- "done":
+            case <-stop:
+                return
+            }
+        }
+    }()
+
+    ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+    defer cancel()
+    sender := coupons.BulkSender(&CreateCouponRequest{StockID: "9856000"}, &BulkOptions{
+        Workers:    1,
+        Rate:       1,
+        Checkpoint: checkpoint,
+    })
+    report, err := sender.Send(ctx, openids)
+    if err != context.DeadlineExceeded {
+        t.Fatalf("got %v, want the deadline", err)
+    }
+    // the report is complete once Send returns
+    skipped := report.Skipped
+    time.Sleep(20 * time.Millisecond)
+    if report.Skipped != skipped {
+        t.Fatalf("skipped changed from %d to %d after Send returned", skipped, report.Skipped)
+    }
+}
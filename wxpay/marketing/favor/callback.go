@@ -2,6 +2,7 @@ package favor
 
 import (
     "context"
+    "errors"
     "net/http"
     "time"
 
@@ -23,7 +24,7 @@ type SetCallbackResponse struct {
 }
 
 func (srv *CallbackService) SetCallback(ctx context.Context, req *SetCallbackRequest) (rsp *SetCallbackResponse, err error) {
-    request, err := srv.Client.NewRequest(http.MethodPost, "marketing/favor/callbacks", req)
+    request, err := srv.Client.NewRequest(ctx, http.MethodPost, "marketing/favor/callbacks", req)
     if err != nil {
         return
     }
@@ -34,3 +35,49 @@ func (srv *CallbackService) SetCallback(ctx context.Context, req *SetCallbackReq
 
     return
 }
+
+type GetCallbackOptions struct {
+    Mchid string `url:"mchid"`
+}
+
+type GetCallbackResponse struct {
+    NotifyURL string `json:"notify_url"`
+    Mchid     string `json:"mchid"`
+}
+
+// GetCallback 查询消息通知地址
+// 可用于核对当前生效的通知地址是否与配置一致
+func (srv *CallbackService) GetCallback(ctx context.Context, mchid string) (rsp *GetCallbackResponse, err error) {
+    if mchid == "" {
+        return nil, errors.New("wxpay: mchid is required")
+    }
+    rawurl, err := client.AddOptions("marketing/favor/callbacks", &GetCallbackOptions{Mchid: mchid})
+    if err != nil {
+        return
+    }
+    request, err := srv.Client.NewRequest(ctx, http.MethodGet, rawurl, nil)
+    if err != nil {
+        return
+    }
+    rsp = &GetCallbackResponse{}
+    if err = srv.Client.Do(request, rsp); err != nil {
+        return
+    }
+
+    return
+}
+
+// CouponUseEvent 代金券核销事件COUPON.USE解密后的内容
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/marketing/convention/chapter3_15.shtml
+type CouponUseEvent struct {
+    Coupon
+    // SingleitemDiscountOff 单品优惠特定信息
+    SingleitemDiscountOff *struct {
+        SinglePriceMax int `json:"single_price_max"`
+    } `json:"singleitem_discount_off,omitempty"`
+    // DiscountTo 减至优惠特定信息
+    DiscountTo *struct {
+        CutToPrice int `json:"cut_to_price"`
+        MaxPrice   int `json:"max_price"`
+    } `json:"discount_to,omitempty"`
+}
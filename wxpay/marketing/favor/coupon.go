@@ -2,6 +2,7 @@ package favor
 
 import (
     "context"
+    "errors"
     "fmt"
     "net/http"
     "time"
@@ -14,8 +15,6 @@ type CouponService client.Service
 
 // Coupon represent a wechat pay coupon
 type Coupon struct {
-    Code              string `json:"code,omitempty"`
-    Message           string `json:"message,omitempty"`
     StockCreatorMchid string `json:"stock_creator_mchid"`
     StockID           string `json:"stock_id"`
     CouponID          string `json:"coupon_id"`
@@ -36,17 +35,23 @@ type Coupon struct {
         CouponAmount       int `json:"coupon_amount"`
         TransactionMinimum int `json:"transaction_minimum"`
     } `json:"normal_coupon_information"`
-    ConsumeInformation struct {
-        ConsumeTime   time.Time `json:"consume_time"`
-        ConsumeMchid  string    `json:"consume_mchid"`
-        TransactionID string    `json:"transaction_id"`
-        GoodsDetail   []struct {
-            GoodsID        string `json:"goods_id"`
-            Quantity       int    `json:"quantity"`
-            Price          int    `json:"price"`
-            DiscountAmount int    `json:"discount_amount"`
-        } `json:"goods_detail"`
-    } `json:"consume_information"`
+    ConsumeInformation ConsumeInformation `json:"consume_information"`
+}
+
+// ConsumeInformation 已实扣代金券核销信息
+type ConsumeInformation struct {
+    ConsumeTime   time.Time      `json:"consume_time"`
+    ConsumeMchid  string         `json:"consume_mchid"`
+    TransactionID string         `json:"transaction_id"`
+    GoodsDetail   []*GoodsDetail `json:"goods_detail"`
+}
+
+// GoodsDetail 单品优惠的商品信息
+type GoodsDetail struct {
+    GoodsID        string `json:"goods_id"`
+    Quantity       int    `json:"quantity"`
+    Price          int    `json:"price"`
+    DiscountAmount int    `json:"discount_amount"`
 }
 
 func (coupon *Coupon) String() string {
@@ -63,14 +68,13 @@ type CreateCouponRequest struct {
 }
 
 type CreateCouponResponse struct {
-    client.ErrorMessage
     CouponID string `json:"coupon_id"`
     TraceNo  string `json:"trace_no"`
 }
 
 func (srv *CouponService) Create(ctx context.Context, openid string, req *CreateCouponRequest) (rsp *CreateCouponResponse, err error) {
     path := fmt.Sprintf("marketing/favor/users/%s/coupons", openid)
-    request, err := srv.Client.NewRequest(http.MethodPost, path, req)
+    request, err := srv.Client.NewRequest(ctx, http.MethodPost, path, req)
     if err != nil {
         return
     }
@@ -91,7 +95,7 @@ func (srv *CouponService) Get(ctx context.Context, appid, couponId, openid strin
     if err != nil {
         return
     }
-    request, err := srv.Client.NewRequest(http.MethodGet, rawurl, nil)
+    request, err := srv.Client.NewRequest(ctx, http.MethodGet, rawurl, nil)
     if err != nil {
         return
     }
@@ -102,3 +106,100 @@ func (srv *CouponService) Get(ctx context.Context, appid, couponId, openid strin
 
     return
 }
+
+const maxUserCouponsLimit = 10
+
+type ListUserCouponsOptions struct {
+    Appid   string `url:"appid"`
+    StockID string `url:"stock_id,omitempty"`
+    // Status 券状态 SENDED：可用 USED：已实扣
+    Status         string `url:"status,omitempty"`
+    CreatorMchid   string `url:"creator_mchid,omitempty"`
+    SenderMchid    string `url:"sender_mchid,omitempty"`
+    AvailableMchid string `url:"available_mchid,omitempty"`
+    // Offset 分页页码，从0开始
+    Offset uint32 `url:"offset"`
+    Limit  uint32 `url:"limit"`
+}
+
+type ListUserCouponsResponse struct {
+    TotalCount int       `json:"total_count"`
+    Data       []*Coupon `json:"data"`
+    Offset     int       `json:"offset"`
+    Limit      int       `json:"limit"`
+}
+
+// ListUserCoupons 根据商户号查用户的券
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/marketing/convention/chapter3_9.shtml
+// CreatorMchid、SenderMchid、AvailableMchid三选一
+func (srv *CouponService) ListUserCoupons(ctx context.Context, openid string, opts *ListUserCouponsOptions) (
+    rsp *ListUserCouponsResponse, err error) {
+    if opts == nil || opts.Appid == "" {
+        return nil, errors.New("wxpay: appid is required")
+    }
+    if opts.CreatorMchid == "" && opts.SenderMchid == "" && opts.AvailableMchid == "" {
+        return nil, errors.New("wxpay: one of creator_mchid, sender_mchid and available_mchid is required")
+    }
+    query := *opts
+    if query.Limit == 0 {
+        query.Limit = maxUserCouponsLimit
+    }
+    if query.Limit > maxUserCouponsLimit {
+        return nil, fmt.Errorf("wxpay: limit %d exceeds %d", query.Limit, maxUserCouponsLimit)
+    }
+    path := fmt.Sprintf("marketing/favor/users/%s/coupons", openid)
+    rawurl, err := client.AddOptions(path, &query)
+    if err != nil {
+        return
+    }
+    request, err := srv.Client.NewRequest(ctx, http.MethodGet, rawurl, nil)
+    if err != nil {
+        return
+    }
+    rsp = &ListUserCouponsResponse{}
+    if err = srv.Client.Do(request, rsp); err != nil {
+        return
+    }
+
+    return
+}
+
+// CouponIterator iterates the pages of ListUserCoupons
+type CouponIterator struct {
+    *client.Iterator
+    coupons []*Coupon
+}
+
+// Coupons returns the coupons of the current page
+func (it *CouponIterator) Coupons() []*Coupon {
+    return it.coupons
+}
+
+// All reads the remaining pages
+func (it *CouponIterator) All(ctx context.Context) (coupons []*Coupon, err error) {
+    for it.Next(ctx) {
+        coupons = append(coupons, it.coupons...)
+    }
+    return coupons, it.Err()
+}
+
+// IterateUserCoupons walks ListUserCoupons page by page
+func (srv *CouponService) IterateUserCoupons(openid string, opts *ListUserCouponsOptions) *CouponIterator {
+    query := ListUserCouponsOptions{}
+    if opts != nil {
+        query = *opts
+    }
+    it := &CouponIterator{}
+    it.Iterator = client.NewIterator(int(query.Limit), func(ctx context.Context, offset, limit int) (n, total int, err error) {
+        query.Offset = uint32(offset)
+        query.Limit = uint32(limit)
+        result, err := srv.ListUserCoupons(ctx, openid, &query)
+        if err != nil {
+            return
+        }
+        it.coupons = result.Data
+        return len(result.Data), result.TotalCount, nil
+    })
+    it.PageNumbered = true
+    return it
+}
@@ -0,0 +1,463 @@
+package favor
+
+import (
+    "fmt"
+    "strings"
+    "time"
+    "unicode/utf8"
+)
+
+// 批次类型
+const (
+    StockTypeNormal   = "NORMAL"
+    StockTypeDiscount = "DISCOUNT"
+    StockTypeExchange = "EXCHANGE"
+)
+
+const (
+    maxAvailableDuration  = 90 * 24 * time.Hour
+    maxCoupons            = 10000000
+    maxCouponsPerUser     = 100
+    maxCouponAmount       = 1000000
+    maxAvailableMerchants = 50
+    maxDescriptionLength  = 1000
+)
+
+// 文字长度限制，汉字与英文字母分别计数
+var (
+    stockNameLimit = textLimit{Chinese: 9, Letters: 20}
+    commentLimit   = textLimit{Chinese: 10, Letters: 20}
+)
+
+// textLimit allows at most Chinese characters or Letters single byte characters,
+// a mixed text uses both budgets in proportion
+type textLimit struct {
+    Chinese int
+    Letters int
+}
+
+func (l textLimit) allows(s string) bool {
+    var chinese, letters int
+    for _, r := range s {
+        if r < utf8.RuneSelf {
+            letters++
+        } else {
+            chinese++
+        }
+    }
+    return chinese*l.Letters+letters*l.Chinese <= l.Chinese*l.Letters
+}
+
+func (l textLimit) String() string {
+    return fmt.Sprintf("at most %d Chinese characters or %d letters", l.Chinese, l.Letters)
+}
+
+// CreateStockRequest 创建代金券批次请求
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/marketing/convention/chapter3_1.shtml
+type CreateStockRequest struct {
+    StockName          string         `json:"stock_name"`
+    Comment            string         `json:"comment,omitempty"`
+    BelongMerchant     string         `json:"belong_merchant"`
+    AvailableBeginTime time.Time      `json:"available_begin_time"`
+    AvailableEndTime   time.Time      `json:"available_end_time"`
+    StockUseRule       *StockUseRule  `json:"stock_use_rule"`
+    PatternInfo        *PatternInfo   `json:"pattern_info,omitempty"`
+    CouponUseRule      *CouponUseRule `json:"coupon_use_rule"`
+    NoCash             bool           `json:"no_cash"`
+    StockType          string         `json:"stock_type"`
+    OutRequestNo       string         `json:"out_request_no"`
+    ExtInfo            string         `json:"ext_info,omitempty"`
+}
+
+// StockUseRule 发放规则
+type StockUseRule struct {
+    MaxCoupons         int64 `json:"max_coupons"`
+    MaxAmount          int64 `json:"max_amount"`
+    MaxAmountByDay     int64 `json:"max_amount_by_day,omitempty"`
+    MaxCouponsPerUser  int   `json:"max_coupons_per_user"`
+    NaturalPersonLimit bool  `json:"natural_person_limit"`
+    PreventAPIAbuse    bool  `json:"prevent_api_abuse"`
+}
+
+// PatternInfo 样式信息
+type PatternInfo struct {
+    Description     string `json:"description"`
+    MerchantLogo    string `json:"merchant_logo,omitempty"`
+    MerchantName    string `json:"merchant_name,omitempty"`
+    BackgroundColor string `json:"background_color,omitempty"`
+    // CouponImage 券详情图片，使用MediaService.UploadImage返回的media_url
+    CouponImage string `json:"coupon_image,omitempty"`
+}
+
+// CouponUseRule 核销规则
+type CouponUseRule struct {
+    CouponAvailableTime *CouponAvailableTime `json:"coupon_available_time,omitempty"`
+    FixedNormalCoupon   *FixedNormalCoupon   `json:"fixed_normal_coupon,omitempty"`
+    DiscountCoupon      *DiscountCoupon      `json:"discount_coupon,omitempty"`
+    ExchangeCoupon      *ExchangeCoupon      `json:"exchange_coupon,omitempty"`
+    GoodsTag            []string             `json:"goods_tag,omitempty"`
+    LimitPay            []string             `json:"limit_pay,omitempty"`
+    TradeType           []string             `json:"trade_type,omitempty"`
+    CombineUse          bool                 `json:"combine_use"`
+    AvailableItems      []string             `json:"available_items,omitempty"`
+    UnavailableItems    []string             `json:"unavailable_items,omitempty"`
+    AvailableMerchants  []string             `json:"available_merchants"`
+}
+
+// CouponAvailableTime 券生效时间
+type CouponAvailableTime struct {
+    FixAvailableTime *FixAvailableTime `json:"fix_available_time,omitempty"`
+    // SecondDayAvailable 领取后第二天生效
+    SecondDayAvailable bool `json:"second_day_available"`
+    // AvailableTimeAfterReceive 领取后有效时长，单位分钟
+    AvailableTimeAfterReceive int `json:"available_time_after_receive,omitempty"`
+}
+
+// FixAvailableTime 固定周期有效时间段
+type FixAvailableTime struct {
+    AvailableWeekDay []int `json:"available_week_day,omitempty"`
+    // BeginTime、EndTime 当天开始、结束的秒数
+    BeginTime int `json:"begin_time"`
+    EndTime   int `json:"end_time"`
+}
+
+// FixedNormalCoupon 固定面额满减券
+type FixedNormalCoupon struct {
+    CouponAmount       int64 `json:"coupon_amount"`
+    TransactionMinimum int64 `json:"transaction_minimum"`
+}
+
+// DiscountCoupon 折扣券
+type DiscountCoupon struct {
+    DiscountAmountMax int64 `json:"discount_amount_max"`
+    // DiscountPercent 折扣百分比，88表示8.8折
+    DiscountPercent    int   `json:"discount_percent"`
+    TransactionMinimum int64 `json:"transaction_minimum"`
+}
+
+// ExchangeCoupon 换购券
+type ExchangeCoupon struct {
+    SinglePriceMax int64 `json:"single_price_max"`
+    ExchangePrice  int64 `json:"exchange_price"`
+}
+
+// FieldError describes an invalid field of a request
+type FieldError struct {
+    Field   string
+    Message string
+}
+
+func (e *FieldError) Error() string {
+    return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationError collects the field errors found before sending a request
+type ValidationError struct {
+    Fields []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+    msgs := make([]string, 0, len(e.Fields))
+    for _, f := range e.Fields {
+        msgs = append(msgs, f.Error())
+    }
+    return "wxpay: invalid request: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) add(field, format string, a ...interface{}) {
+    e.Fields = append(e.Fields, &FieldError{Field: field, Message: fmt.Sprintf(format, a...)})
+}
+
+func (e *ValidationError) err() error {
+    if len(e.Fields) == 0 {
+        return nil
+    }
+    return e
+}
+
+// Validate checks the request against the constraints of the API
+func (req *CreateStockRequest) Validate() error {
+    v := &ValidationError{}
+
+    if req.StockName == "" {
+        v.add("stock_name", "is required")
+    } else if !stockNameLimit.allows(req.StockName) {
+        v.add("stock_name", "is too long, %s", stockNameLimit)
+    }
+    if !commentLimit.allows(req.Comment) {
+        v.add("comment", "is too long, %s", commentLimit)
+    }
+    if req.BelongMerchant == "" {
+        v.add("belong_merchant", "is required")
+    }
+    if req.OutRequestNo == "" {
+        v.add("out_request_no", "is required")
+    }
+
+    switch {
+    case req.AvailableBeginTime.IsZero():
+        v.add("available_begin_time", "is required")
+    case req.AvailableEndTime.IsZero():
+        v.add("available_end_time", "is required")
+    case !req.AvailableEndTime.After(req.AvailableBeginTime):
+        v.add("available_end_time", "must be after available_begin_time")
+    case req.AvailableEndTime.Sub(req.AvailableBeginTime) > maxAvailableDuration:
+        v.add("available_end_time", "must be within 90 days after available_begin_time")
+    case req.AvailableEndTime.Before(time.Now()):
+        v.add("available_end_time", "is in the past")
+    }
+
+    if req.PatternInfo != nil && utf8.RuneCountInString(req.PatternInfo.Description) > maxDescriptionLength {
+        v.add("pattern_info.description", "has more than %d characters", maxDescriptionLength)
+    }
+
+    faceValue := req.validateCouponUseRule(v)
+    req.validateStockUseRule(v, faceValue)
+
+    return v.err()
+}
+
+// validateCouponUseRule returns the amount each coupon consumes from the budget
+func (req *CreateStockRequest) validateCouponUseRule(v *ValidationError) (faceValue int64) {
+    rule := req.CouponUseRule
+    if rule == nil {
+        v.add("coupon_use_rule", "is required")
+        return
+    }
+
+    switch req.StockType {
+    case StockTypeNormal:
+        c := rule.FixedNormalCoupon
+        if c == nil {
+            v.add("coupon_use_rule.fixed_normal_coupon", "is required for %s stock", req.StockType)
+            return
+        }
+        if c.CouponAmount <= 0 || c.CouponAmount > maxCouponAmount {
+            v.add("coupon_use_rule.fixed_normal_coupon.coupon_amount", "must be within 1 and %d", maxCouponAmount)
+        }
+        if c.TransactionMinimum <= c.CouponAmount {
+            v.add("coupon_use_rule.fixed_normal_coupon.transaction_minimum", "must be greater than coupon_amount")
+        }
+        faceValue = c.CouponAmount
+    case StockTypeDiscount:
+        c := rule.DiscountCoupon
+        if c == nil {
+            v.add("coupon_use_rule.discount_coupon", "is required for %s stock", req.StockType)
+            return
+        }
+        if c.DiscountPercent <= 0 || c.DiscountPercent >= 100 {
+            v.add("coupon_use_rule.discount_coupon.discount_percent", "must be within 1 and 99")
+        }
+        if c.DiscountAmountMax <= 0 || c.DiscountAmountMax > maxCouponAmount {
+            v.add("coupon_use_rule.discount_coupon.discount_amount_max", "must be within 1 and %d", maxCouponAmount)
+        }
+        if c.TransactionMinimum < 0 {
+            v.add("coupon_use_rule.discount_coupon.transaction_minimum", "must not be negative")
+        }
+        faceValue = c.DiscountAmountMax
+    case StockTypeExchange:
+        c := rule.ExchangeCoupon
+        if c == nil {
+            v.add("coupon_use_rule.exchange_coupon", "is required for %s stock", req.StockType)
+            return
+        }
+        if c.SinglePriceMax <= 0 {
+            v.add("coupon_use_rule.exchange_coupon.single_price_max", "must be positive")
+        }
+        if c.ExchangePrice <= 0 || c.ExchangePrice >= c.SinglePriceMax {
+            v.add("coupon_use_rule.exchange_coupon.exchange_price", "must be positive and less than single_price_max")
+        }
+        faceValue = c.SinglePriceMax - c.ExchangePrice
+    default:
+        v.add("stock_type", "unknown type %q", req.StockType)
+        return
+    }
+
+    if n := len(rule.AvailableMerchants); n == 0 {
+        v.add("coupon_use_rule.available_merchants", "is required")
+    } else if n > maxAvailableMerchants {
+        v.add("coupon_use_rule.available_merchants", "has %d merchants, at most %d", n, maxAvailableMerchants)
+    }
+    if req.NoCash {
+        // 免充值券由核销商户出资，创建商户须在可用商户内
+        found := false
+        for _, mchid := range rule.AvailableMerchants {
+            if mchid == req.BelongMerchant {
+                found = true
+                break
+            }
+        }
+        if !found {
+            v.add("coupon_use_rule.available_merchants", "must contain belong_merchant for no cash stock")
+        }
+    }
+
+    if t := rule.CouponAvailableTime; t != nil && t.FixAvailableTime != nil {
+        f := t.FixAvailableTime
+        if f.BeginTime < 0 || f.EndTime > 86399 || f.BeginTime >= f.EndTime {
+            v.add("coupon_use_rule.coupon_available_time.fix_available_time", "begin_time and end_time must be seconds within a day, begin before end")
+        }
+        for _, day := range f.AvailableWeekDay {
+            if day < 0 || day > 6 {
+                v.add("coupon_use_rule.coupon_available_time.fix_available_time.available_week_day", "invalid week day %d", day)
+            }
+        }
+    }
+    return
+}
+
+func (req *CreateStockRequest) validateStockUseRule(v *ValidationError, faceValue int64) {
+    rule := req.StockUseRule
+    if rule == nil {
+        v.add("stock_use_rule", "is required")
+        return
+    }
+    if rule.MaxCoupons <= 0 || rule.MaxCoupons > maxCoupons {
+        v.add("stock_use_rule.max_coupons", "must be within 1 and %d", maxCoupons)
+    }
+    if rule.MaxCouponsPerUser <= 0 || rule.MaxCouponsPerUser > maxCouponsPerUser {
+        v.add("stock_use_rule.max_coupons_per_user", "must be within 1 and %d", maxCouponsPerUser)
+    } else if int64(rule.MaxCouponsPerUser) > rule.MaxCoupons {
+        v.add("stock_use_rule.max_coupons_per_user", "must not exceed max_coupons")
+    }
+    if faceValue > 0 && rule.MaxCoupons > 0 && rule.MaxAmount != rule.MaxCoupons*faceValue {
+        v.add("stock_use_rule.max_amount", "must equal max_coupons * %d = %d", faceValue, rule.MaxCoupons*faceValue)
+    }
+    if rule.MaxAmountByDay < 0 || rule.MaxAmountByDay > rule.MaxAmount {
+        v.add("stock_use_rule.max_amount_by_day", "must be within 0 and max_amount")
+    } else if rule.MaxAmountByDay > 0 && faceValue > 0 && rule.MaxAmountByDay < faceValue {
+        v.add("stock_use_rule.max_amount_by_day", "must allow at least one coupon per day")
+    }
+    if rule.NaturalPersonLimit && !rule.PreventAPIAbuse {
+        v.add("stock_use_rule.prevent_api_abuse", "must be set with natural_person_limit")
+    }
+}
+
+// StockBuilder builds a CreateStockRequest step by step, Build validates it
+//
+//	req, err := favor.NewFixedNormalStock("满100减10", "1900000001", "req-20200101", 1000, 10000, 500).
+//	    AvailableTime(begin, end).
+//	    AvailableMerchants("1900000001").
+//	    Build()
+type StockBuilder struct {
+    req *CreateStockRequest
+}
+
+func newStockBuilder(stockType, name, belongMerchant, outRequestNo string, maxCoupons int64) *StockBuilder {
+    return &StockBuilder{req: &CreateStockRequest{
+        StockName:      name,
+        BelongMerchant: belongMerchant,
+        OutRequestNo:   outRequestNo,
+        StockType:      stockType,
+        StockUseRule: &StockUseRule{
+            MaxCoupons:        maxCoupons,
+            MaxCouponsPerUser: 1,
+        },
+        CouponUseRule: &CouponUseRule{},
+    }}
+}
+
+// NewFixedNormalStock 满减券，amount为面额，minimum为使用门槛，单位分；总预算按发放上限计算
+func NewFixedNormalStock(name, belongMerchant, outRequestNo string, amount, minimum, maxCoupons int64) *StockBuilder {
+    b := newStockBuilder(StockTypeNormal, name, belongMerchant, outRequestNo, maxCoupons)
+    b.req.CouponUseRule.FixedNormalCoupon = &FixedNormalCoupon{CouponAmount: amount, TransactionMinimum: minimum}
+    b.req.StockUseRule.MaxAmount = amount * maxCoupons
+    return b
+}
+
+// NewDiscountStock 折扣券，percent为折扣百分比，amountMax为单券最高优惠，单位分
+func NewDiscountStock(name, belongMerchant, outRequestNo string, percent int, amountMax, minimum, maxCoupons int64) *StockBuilder {
+    b := newStockBuilder(StockTypeDiscount, name, belongMerchant, outRequestNo, maxCoupons)
+    b.req.CouponUseRule.DiscountCoupon = &DiscountCoupon{
+        DiscountPercent:    percent,
+        DiscountAmountMax:  amountMax,
+        TransactionMinimum: minimum,
+    }
+    b.req.StockUseRule.MaxAmount = amountMax * maxCoupons
+    return b
+}
+
+// NewExchangeStock 换购券，singlePriceMax为单品最高价，exchangePrice为换购价，单位分
+func NewExchangeStock(name, belongMerchant, outRequestNo string, singlePriceMax, exchangePrice, maxCoupons int64) *StockBuilder {
+    b := newStockBuilder(StockTypeExchange, name, belongMerchant, outRequestNo, maxCoupons)
+    b.req.CouponUseRule.ExchangeCoupon = &ExchangeCoupon{SinglePriceMax: singlePriceMax, ExchangePrice: exchangePrice}
+    b.req.StockUseRule.MaxAmount = (singlePriceMax - exchangePrice) * maxCoupons
+    return b
+}
+
+func (b *StockBuilder) Comment(comment string) *StockBuilder {
+    b.req.Comment = comment
+    return b
+}
+
+func (b *StockBuilder) AvailableTime(begin, end time.Time) *StockBuilder {
+    b.req.AvailableBeginTime = inChina(begin)
+    b.req.AvailableEndTime = inChina(end)
+    return b
+}
+
+func (b *StockBuilder) MaxCouponsPerUser(n int) *StockBuilder {
+    b.req.StockUseRule.MaxCouponsPerUser = n
+    return b
+}
+
+func (b *StockBuilder) MaxAmountByDay(amount int64) *StockBuilder {
+    b.req.StockUseRule.MaxAmountByDay = amount
+    return b
+}
+
+// NaturalPersonLimit 限制同一自然人领取，preventAPIAbuse 防刷
+func (b *StockBuilder) NaturalPersonLimit(limit, preventAPIAbuse bool) *StockBuilder {
+    b.req.StockUseRule.NaturalPersonLimit = limit
+    b.req.StockUseRule.PreventAPIAbuse = preventAPIAbuse
+    return b
+}
+
+// NoCash 免充值批次
+func (b *StockBuilder) NoCash(noCash bool) *StockBuilder {
+    b.req.NoCash = noCash
+    return b
+}
+
+func (b *StockBuilder) AvailableMerchants(mchids ...string) *StockBuilder {
+    b.req.CouponUseRule.AvailableMerchants = append(b.req.CouponUseRule.AvailableMerchants, mchids...)
+    return b
+}
+
+func (b *StockBuilder) AvailableItems(items ...string) *StockBuilder {
+    b.req.CouponUseRule.AvailableItems = append(b.req.CouponUseRule.AvailableItems, items...)
+    return b
+}
+
+func (b *StockBuilder) GoodsTag(tags ...string) *StockBuilder {
+    b.req.CouponUseRule.GoodsTag = append(b.req.CouponUseRule.GoodsTag, tags...)
+    return b
+}
+
+func (b *StockBuilder) TradeType(types ...string) *StockBuilder {
+    b.req.CouponUseRule.TradeType = append(b.req.CouponUseRule.TradeType, types...)
+    return b
+}
+
+func (b *StockBuilder) CombineUse(combine bool) *StockBuilder {
+    b.req.CouponUseRule.CombineUse = combine
+    return b
+}
+
+func (b *StockBuilder) CouponAvailableTime(t *CouponAvailableTime) *StockBuilder {
+    b.req.CouponUseRule.CouponAvailableTime = t
+    return b
+}
+
+func (b *StockBuilder) Pattern(pattern *PatternInfo) *StockBuilder {
+    b.req.PatternInfo = pattern
+    return b
+}
+
+// Build validates and returns the request
+func (b *StockBuilder) Build() (*CreateStockRequest, error) {
+    if err := b.req.Validate(); err != nil {
+        return nil, err
+    }
+    return b.req, nil
+}
@@ -0,0 +1,89 @@
+package favor
+
+import (
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestTextLimit(t *testing.T) {
+    tests := []struct {
+        limit textLimit
+        text  string
+        ok    bool
+    }{
+        {stockNameLimit, "满一百元减十元优惠券", false},
+        {stockNameLimit, "满一百减十元优惠券", true},
+        {stockNameLimit, strings.Repeat("a", 20), true},
+        {stockNameLimit, strings.Repeat("a", 21), false},
+        {stockNameLimit, "满100减10", true},
+        {stockNameLimit, "满一百元减十元券abc", false},
+        {commentLimit, strings.Repeat("券", 10), true},
+        {commentLimit, strings.Repeat("券", 11), false},
+        {commentLimit, strings.Repeat("a", 20), true},
+        {commentLimit, "", true},
+    }
+    for _, tt := range tests {
+        if ok := tt.limit.allows(tt.text); ok != tt.ok {
+            t.Errorf("%v allows %q = %v, want %v", tt.limit, tt.text, ok, tt.ok)
+        }
+    }
+}
+
+func newTestStock() *StockBuilder {
+    begin := time.Now().Add(time.Hour)
+    return NewFixedNormalStock("满100减10", "1900000001", "req-20200101", 1000, 10000, 500).
+        AvailableTime(begin, begin.Add(24*time.Hour)).
+        AvailableMerchants("1900000001")
+}
+
+// fieldsOf returns the fields of a ValidationError
+func fieldsOf(t *testing.T, err error) []string {
+    if err == nil {
+        return nil
+    }
+    v, ok := err.(*ValidationError)
+    if !ok {
+        t.Fatalf("got %v, want a ValidationError", err)
+    }
+    fields := make([]string, 0, len(v.Fields))
+    for _, f := range v.Fields {
+        fields = append(fields, f.Field)
+    }
+    return fields
+}
+
+func TestBuildStock(t *testing.T) {
+    tests := []struct {
+        name  string
+        build func(b *StockBuilder) *StockBuilder
+        field string
+    }{
+        {"valid", func(b *StockBuilder) *StockBuilder {
+            return b.Comment(strings.Repeat("a", 20)).NoCash(true).NaturalPersonLimit(true, true)
+        }, ""},
+        {"comment too long", func(b *StockBuilder) *StockBuilder {
+            return b.Comment(strings.Repeat("券", 11))
+        }, "comment"},
+        {"no cash without the creator", func(b *StockBuilder) *StockBuilder {
+            b.req.CouponUseRule.AvailableMerchants = []string{"1900000002"}
+            return b.NoCash(true)
+        }, "coupon_use_rule.available_merchants"},
+        {"natural person limit without prevent api abuse", func(b *StockBuilder) *StockBuilder {
+            return b.NaturalPersonLimit(true, false)
+        }, "stock_use_rule.prevent_api_abuse"},
+    }
+    for _, tt := range tests {
+        _, err := tt.build(newTestStock()).Build()
+        fields := fieldsOf(t, err)
+        if tt.field == "" {
+            if err != nil {
+                t.Errorf("%s: %v", tt.name, err)
+            }
+            continue
+        }
+        if len(fields) != 1 || fields[0] != tt.field {
+            t.Errorf("%s: got errors on %v, want %s", tt.name, fields, tt.field)
+        }
+    }
+}
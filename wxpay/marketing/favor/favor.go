@@ -11,6 +11,7 @@ type Favor struct {
     Stock    *StockService
     Coupon   *CouponService
     Callback *CallbackService
+    Media    *MediaService
 }
 
 func New(ctx context.Context, srv *client.Service) *Favor {
@@ -18,6 +19,7 @@ func New(ctx context.Context, srv *client.Service) *Favor {
     favor.Stock = (*StockService)(srv)
     favor.Coupon = (*CouponService)(srv)
     favor.Callback = (*CallbackService)(srv)
+    favor.Media = (*MediaService)(srv)
     
     return favor
 }
@@ -0,0 +1,290 @@
+package favor
+
+import (
+    "bytes"
+    "context"
+    "encoding/csv"
+    "fmt"
+    "io"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const flowTimeLayout = "2006-01-02 15:04:05"
+
+type FlowResponse struct {
+    URL       string `json:"url"`
+    HashValue string `json:"hash_value"`
+    HashType  string `json:"hash_type"`
+}
+
+// UseFlowRecord 核销明细
+type UseFlowRecord struct {
+    StockID    string
+    CouponID   string
+    CouponType string
+    // CouponAmount 优惠金额，单位分
+    CouponAmount int64
+    // TotalAmount 订单总金额，单位分
+    TotalAmount   int64
+    TradeType     string
+    TransactionID string
+    ConsumeTime   time.Time
+    ConsumeMchid  string
+    DeviceNo      string
+    BankSerialNo  string
+    GoodsInfo     string
+    // Fields keeps every column of the row by header name
+    Fields map[string]string
+}
+
+// RefundFlowRecord 退款明细
+type RefundFlowRecord struct {
+    StockID       string
+    CouponID      string
+    CouponType    string
+    CouponAmount  int64
+    TotalAmount   int64
+    TransactionID string
+    RefundID      string
+    RefundTime    time.Time
+    RefundAmount  int64
+    Fields        map[string]string
+}
+
+// IssueFlowRecord 发放明细
+type IssueFlowRecord struct {
+    StockID    string
+    CouponID   string
+    CouponType string
+    Amount     int64
+    Openid     string
+    IssueTime  time.Time
+    Fields     map[string]string
+}
+
+// UseFlow 下载批次核销明细
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/marketing/convention/chapter3_10.shtml
+// 可获取到某批次的核销明细数据，包括订单号、单品信息、银行流水号等，用于对账/数据分析
+func (srv *StockService) UseFlow(ctx context.Context, stockID string) (result *FlowResponse, err error) {
+    return srv.flow(ctx, stockID, "use-flow")
+}
+
+// RefundFlow 下载批次退款明细
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/marketing/convention/chapter3_11.shtml
+func (srv *StockService) RefundFlow(ctx context.Context, stockID string) (result *FlowResponse, err error) {
+    return srv.flow(ctx, stockID, "refund-flow")
+}
+
+// IssueFlow 下载批次发放明细
+func (srv *StockService) IssueFlow(ctx context.Context, stockID string) (result *FlowResponse, err error) {
+    return srv.flow(ctx, stockID, "issue-flow")
+}
+
+func (srv *StockService) flow(ctx context.Context, stockID, kind string) (result *FlowResponse, err error) {
+    path := fmt.Sprintf("marketing/favor/stocks/%s/%s", stockID, kind)
+    req, err := srv.Client.NewRequest(ctx, http.MethodGet, path, nil)
+    if err != nil {
+        return
+    }
+
+    result = &FlowResponse{}
+    err = srv.Client.Do(req, result)
+    if err != nil {
+        return
+    }
+
+    return
+}
+
+// DownloadUseFlow downloads, verifies and parses the use flow of the stock
+func (srv *StockService) DownloadUseFlow(ctx context.Context, stockID string) (records []*UseFlowRecord, err error) {
+    rows, err := srv.downloadFlow(ctx, stockID, srv.UseFlow)
+    if err != nil {
+        return
+    }
+    for _, row := range rows {
+        record := &UseFlowRecord{
+            StockID:       row.get("批次id"),
+            CouponID:      row.get("优惠id"),
+            CouponType:    row.get("优惠类型"),
+            TradeType:     row.get("交易类型"),
+            TransactionID: row.get("支付单号"),
+            ConsumeMchid:  row.get("消耗商户号"),
+            DeviceNo:      row.get("设备号"),
+            BankSerialNo:  row.get("银行流水号"),
+            GoodsInfo:     row.get("单品信息"),
+            Fields:        row.fields,
+        }
+        if record.CouponAmount, err = row.amount("优惠金额（元）"); err != nil {
+            return
+        }
+        if record.TotalAmount, err = row.amount("订单总金额（元）"); err != nil {
+            return
+        }
+        if record.ConsumeTime, err = row.time("消耗时间"); err != nil {
+            return
+        }
+        records = append(records, record)
+    }
+    return
+}
+
+// DownloadRefundFlow downloads, verifies and parses the refund flow of the stock
+func (srv *StockService) DownloadRefundFlow(ctx context.Context, stockID string) (records []*RefundFlowRecord, err error) {
+    rows, err := srv.downloadFlow(ctx, stockID, srv.RefundFlow)
+    if err != nil {
+        return
+    }
+    for _, row := range rows {
+        record := &RefundFlowRecord{
+            StockID:       row.get("批次id"),
+            CouponID:      row.get("优惠id"),
+            CouponType:    row.get("优惠类型"),
+            TransactionID: row.get("支付单号"),
+            RefundID:      row.get("退款单号"),
+            Fields:        row.fields,
+        }
+        if record.CouponAmount, err = row.amount("优惠金额（元）"); err != nil {
+            return
+        }
+        if record.TotalAmount, err = row.amount("订单总金额（元）"); err != nil {
+            return
+        }
+        if record.RefundAmount, err = row.amount("退款金额（元）"); err != nil {
+            return
+        }
+        if record.RefundTime, err = row.time("退款时间"); err != nil {
+            return
+        }
+        records = append(records, record)
+    }
+    return
+}
+
+// DownloadIssueFlow downloads, verifies and parses the issue flow of the stock
+func (srv *StockService) DownloadIssueFlow(ctx context.Context, stockID string) (records []*IssueFlowRecord, err error) {
+    rows, err := srv.downloadFlow(ctx, stockID, srv.IssueFlow)
+    if err != nil {
+        return
+    }
+    for _, row := range rows {
+        record := &IssueFlowRecord{
+            StockID:    row.get("批次id"),
+            CouponID:   row.get("优惠id"),
+            CouponType: row.get("优惠类型"),
+            Openid:     row.get("用户openid"),
+            Fields:     row.fields,
+        }
+        if record.Amount, err = row.amount("面额（元）"); err != nil {
+            return
+        }
+        if record.IssueTime, err = row.time("发放时间"); err != nil {
+            return
+        }
+        records = append(records, record)
+    }
+    return
+}
+
+func (srv *StockService) downloadFlow(ctx context.Context, stockID string,
+    describe func(ctx context.Context, stockID string) (*FlowResponse, error)) (rows []*flowRow, err error) {
+    flow, err := describe(ctx, stockID)
+    if err != nil {
+        return
+    }
+    content, err := srv.Client.Download(ctx, flow.URL, flow.HashType, flow.HashValue)
+    if err != nil {
+        return
+    }
+    return parseFlow(content)
+}
+
+// flowRow is a CSV row keyed by header name
+type flowRow struct {
+    line   int
+    fields map[string]string
+}
+
+func (row *flowRow) get(name string) string {
+    return row.fields[name]
+}
+
+// amount converts a yuan column to fen
+func (row *flowRow) amount(name string) (int64, error) {
+    value := row.get(name)
+    if value == "" {
+        return 0, nil
+    }
+    yuan, err := strconv.ParseFloat(value, 64)
+    if err != nil {
+        return 0, fmt.Errorf("wxpay: line %d: invalid %s %q", row.line, name, value)
+    }
+    return int64(math.Round(yuan * 100)), nil
+}
+
+func (row *flowRow) time(name string) (t time.Time, err error) {
+    value := row.get(name)
+    if value == "" {
+        return
+    }
+    if t, err = time.ParseInLocation(flowTimeLayout, value, chinaZone); err != nil {
+        return t, fmt.Errorf("wxpay: line %d: invalid %s %q", row.line, name, value)
+    }
+    return
+}
+
+// parseFlow parses the CSV flow file, values may be prefixed by ` to keep them as text
+func parseFlow(content []byte) (rows []*flowRow, err error) {
+    content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+    r := csv.NewReader(bytes.NewReader(content))
+    r.FieldsPerRecord = -1
+    r.LazyQuotes = true
+
+    header, err := r.Read()
+    if err == io.EOF {
+        return nil, nil
+    }
+    if err != nil {
+        return
+    }
+    for i := range header {
+        header[i] = cleanFlowValue(header[i])
+    }
+
+    for line := 2; ; line++ {
+        var record []string
+        record, err = r.Read()
+        if err == io.EOF {
+            return rows, nil
+        }
+        if err != nil {
+            return
+        }
+        // the summary lines follow the detail rows
+        if isFlowSummary(record) {
+            return rows, nil
+        }
+        if len(record) != len(header) {
+            return nil, fmt.Errorf("wxpay: line %d: %d columns, want %d", line, len(record), len(header))
+        }
+        row := &flowRow{line: line, fields: make(map[string]string, len(header))}
+        for i, name := range header {
+            row.fields[name] = cleanFlowValue(record[i])
+        }
+        rows = append(rows, row)
+    }
+}
+
+// isFlowSummary reports whether the record starts the summary, e.g. 总条数,总金额
+func isFlowSummary(record []string) bool {
+    first := cleanFlowValue(record[0])
+    return strings.HasPrefix(first, "总") || strings.HasPrefix(first, "汇总")
+}
+
+func cleanFlowValue(value string) string {
+    return strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(value), "`"))
+}
@@ -0,0 +1,69 @@
+package favor
+
+import (
+    "strings"
+    "testing"
+)
+
+const testUseFlow = "\xef\xbb\xbf批次id,优惠id,优惠金额（元）,消耗时间,单品信息\n" +
+    "`9865000,`12345678901,`10.05,`2021-01-02 03:04:05,\"`[{\"\"goods_id\"\":\"\"a,b\"\"}]\"\n" +
+    "`9865000,`12345678902,`0.10,`2021-01-02 03:04:06,\n" +
+    "总条数,总优惠金额（元）\n" +
+    "`2,`10.15\n"
+
+func TestParseFlow(t *testing.T) {
+    rows, err := parseFlow([]byte(testUseFlow))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(rows) != 2 {
+        t.Fatalf("got %d rows, want the 2 detail rows", len(rows))
+    }
+
+    row := rows[0]
+    // the BOM is not part of the first header
+    if got := row.get("批次id"); got != "9865000" {
+        t.Fatalf("批次id = %q", got)
+    }
+    if got := row.get("优惠id"); got != "12345678901" {
+        t.Fatalf("优惠id = %q", got)
+    }
+    if got := row.get("单品信息"); got != `[{"goods_id":"a,b"}]` {
+        t.Fatalf("单品信息 = %q", got)
+    }
+    amount, err := row.amount("优惠金额（元）")
+    if err != nil || amount != 1005 {
+        t.Fatalf("优惠金额 = %d, %v", amount, err)
+    }
+    consumed, err := row.time("消耗时间")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := consumed.UTC().Format(flowTimeLayout); got != "2021-01-01 19:04:05" {
+        t.Fatalf("消耗时间 = %s UTC, want the time of China", got)
+    }
+
+    if amount, _ = rows[1].amount("优惠金额（元）"); amount != 10 {
+        t.Fatalf("优惠金额 = %d, want 10", amount)
+    }
+}
+
+func TestParseFlowColumnCount(t *testing.T) {
+    content := "批次id,优惠id,优惠金额（元）\n" +
+        "`9865000,`12345678901,`10.05\n" +
+        "`9865000,`12345678902\n"
+    _, err := parseFlow([]byte(content))
+    if err == nil {
+        t.Fatal("a row with missing columns is accepted")
+    }
+    if !strings.Contains(err.Error(), "line 3") {
+        t.Fatalf("error %q does not name the line", err)
+    }
+}
+
+func TestParseFlowEmpty(t *testing.T) {
+    rows, err := parseFlow([]byte("\xef\xbb\xbf"))
+    if err != nil || rows != nil {
+        t.Fatalf("got %v, %v", rows, err)
+    }
+}
@@ -0,0 +1,86 @@
+package favor
+
+import (
+    "context"
+    "errors"
+    "fmt"
+)
+
+// StockAction 批次操作
+type StockAction string
+
+const (
+    StockActionStart   StockAction = "start"
+    StockActionPause   StockAction = "pause"
+    StockActionRestart StockAction = "restart"
+)
+
+// stockTransitions lists the status each action is allowed from and the status it leads to
+var stockTransitions = map[StockAction]struct {
+    from StockStatus
+    to   StockStatus
+}{
+    StockActionStart:   {from: StockStatusUnactivated, to: StockStatusRunning},
+    StockActionPause:   {from: StockStatusRunning, to: StockStatusPaused},
+    StockActionRestart: {from: StockStatusPaused, to: StockStatusRunning},
+}
+
+var ErrIllegalTransition = errors.New("wxpay: illegal stock transition")
+
+// TransitionError is returned when an action is not allowed in the current status of the stock
+type TransitionError struct {
+    StockID string
+    Status  StockStatus
+    Action  StockAction
+}
+
+func (e *TransitionError) Error() string {
+    return fmt.Sprintf("wxpay: can not %s stock %s in status %s", e.Action, e.StockID, e.Status)
+}
+
+func (e *TransitionError) Is(target error) bool {
+    return target == ErrIllegalTransition
+}
+
+// CanTransition reports whether action is allowed in status
+func CanTransition(status StockStatus, action StockAction) bool {
+    t, ok := stockTransitions[action]
+    return ok && t.from == status
+}
+
+// NextStatus returns the status the stock reaches after action
+func NextStatus(status StockStatus, action StockAction) (StockStatus, bool) {
+    if !CanTransition(status, action) {
+        return status, false
+    }
+    return stockTransitions[action].to, true
+}
+
+// Transition fetches the stock, validates the action against its status and performs it
+func (srv *StockService) Transition(ctx context.Context, stockCreatorMchId, stockID string, action StockAction) (
+    status StockStatus, err error) {
+    if _, ok := stockTransitions[action]; !ok {
+        return "", fmt.Errorf("wxpay: unknown stock action %q", action)
+    }
+    stock, err := srv.GetStock(ctx, stockCreatorMchId, stockID)
+    if err != nil {
+        return
+    }
+    next, ok := NextStatus(stock.Status, action)
+    if !ok {
+        return stock.Status, &TransitionError{StockID: stockID, Status: stock.Status, Action: action}
+    }
+
+    switch action {
+    case StockActionStart:
+        _, err = srv.ActivateStock(ctx, stockCreatorMchId, stockID)
+    case StockActionPause:
+        _, err = srv.PauseStock(ctx, stockCreatorMchId, stockID)
+    case StockActionRestart:
+        _, err = srv.RestartStock(ctx, stockCreatorMchId, stockID)
+    }
+    if err != nil {
+        return stock.Status, err
+    }
+    return next, nil
+}
@@ -0,0 +1,45 @@
+package favor
+
+import (
+    "context"
+    "io/ioutil"
+
+    "github.com/yunlyz/go-wechat/wxpay/client"
+)
+
+const maxImageSize = 2 << 20
+
+var imageExts = []string{".jpg", ".jpeg", ".bmp", ".png"}
+
+type MediaService client.Service
+
+type UploadImageResponse struct {
+    MediaURL string `json:"media_url"`
+}
+
+// UploadImage 图片上传(营销专用)
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/marketing/chapter9_0_1.shtml
+// 返回的media_url可用于代金券批次的PatternInfo.CouponImage
+func (srv *MediaService) UploadImage(ctx context.Context, filename string, content []byte) (rsp *UploadImageResponse, err error) {
+    if err = client.ValidateMedia(filename, content, imageExts, maxImageSize); err != nil {
+        return
+    }
+    request, err := srv.Client.NewUploadRequest(ctx, "marketing/favor/media/image-upload", filename, content)
+    if err != nil {
+        return
+    }
+    rsp = &UploadImageResponse{}
+    if err = srv.Client.Do(request, rsp); err != nil {
+        return
+    }
+    return
+}
+
+// UploadImageFile reads and uploads a local image
+func (srv *MediaService) UploadImageFile(ctx context.Context, path string) (rsp *UploadImageResponse, err error) {
+    content, err := ioutil.ReadFile(path)
+    if err != nil {
+        return
+    }
+    return srv.UploadImage(ctx, path, content)
+}
@@ -0,0 +1,160 @@
+package favor
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+
+    "github.com/yunlyz/go-wechat/wxpay/client"
+)
+
+const (
+    maxMerchantsLimit = 50
+    maxItemsLimit     = 100
+)
+
+type ListStockOptions struct {
+    // Offset 分页页码，从0开始
+    Offset            uint32 `url:"offset"`
+    Limit             uint32 `url:"limit"`
+    StockCreatorMchid string `url:"stock_creator_mchid"`
+}
+
+type ListMerchantsResponse struct {
+    TotalCount int      `json:"total_count"`
+    Data       []string `json:"data"`
+    Offset     int      `json:"offset"`
+    Limit      int      `json:"limit"`
+    StockID    string   `json:"stock_id"`
+}
+
+type ListItemsResponse struct {
+    TotalCount int      `json:"total_count"`
+    Data       []string `json:"data"`
+    Offset     int      `json:"offset"`
+    Limit      int      `json:"limit"`
+    StockID    string   `json:"stock_id"`
+}
+
+// ListAvailableMerchants 查询代金券可用商户
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/marketing/convention/chapter3_6.shtml
+func (srv *StockService) ListAvailableMerchants(ctx context.Context, stockID string, opts *ListStockOptions) (
+    result *ListMerchantsResponse, err error) {
+    rawurl, err := listStockURL(fmt.Sprintf("marketing/favor/stocks/%s/merchants", stockID), opts, maxMerchantsLimit)
+    if err != nil {
+        return
+    }
+    req, err := srv.Client.NewRequest(ctx, http.MethodGet, rawurl, nil)
+    if err != nil {
+        return
+    }
+
+    result = &ListMerchantsResponse{}
+    err = srv.Client.Do(req, result)
+    if err != nil {
+        return
+    }
+
+    return
+}
+
+// ListAvailableItems 查询可核销商品编码
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/marketing/convention/chapter3_7.shtml
+func (srv *StockService) ListAvailableItems(ctx context.Context, stockID string, opts *ListStockOptions) (
+    result *ListItemsResponse, err error) {
+    rawurl, err := listStockURL(fmt.Sprintf("marketing/favor/stocks/%s/items", stockID), opts, maxItemsLimit)
+    if err != nil {
+        return
+    }
+    req, err := srv.Client.NewRequest(ctx, http.MethodGet, rawurl, nil)
+    if err != nil {
+        return
+    }
+
+    result = &ListItemsResponse{}
+    err = srv.Client.Do(req, result)
+    if err != nil {
+        return
+    }
+
+    return
+}
+
+func listStockURL(path string, opts *ListStockOptions, maxLimit uint32) (rawurl string, err error) {
+    if opts == nil || opts.StockCreatorMchid == "" {
+        return "", fmt.Errorf("wxpay: stock_creator_mchid is required")
+    }
+    query := *opts
+    if query.Limit == 0 {
+        query.Limit = maxLimit
+    }
+    if query.Limit > maxLimit {
+        return "", fmt.Errorf("wxpay: limit %d exceeds %d", query.Limit, maxLimit)
+    }
+    return client.AddOptions(path, &query)
+}
+
+// StringIterator iterates the pages of lists of ids
+type StringIterator struct {
+    *client.Iterator
+    data []string
+}
+
+// Data returns the ids of the current page
+func (it *StringIterator) Data() []string {
+    return it.data
+}
+
+// All reads the remaining pages
+func (it *StringIterator) All(ctx context.Context) (data []string, err error) {
+    for it.Next(ctx) {
+        data = append(data, it.data...)
+    }
+    return data, it.Err()
+}
+
+// IterateAvailableMerchants walks ListAvailableMerchants page by page
+func (srv *StockService) IterateAvailableMerchants(stockID string, opts *ListStockOptions) *StringIterator {
+    return newStringIterator(opts, maxMerchantsLimit, func(ctx context.Context, query *ListStockOptions) ([]string, int, error) {
+        result, err := srv.ListAvailableMerchants(ctx, stockID, query)
+        if err != nil {
+            return nil, 0, err
+        }
+        return result.Data, result.TotalCount, nil
+    })
+}
+
+// IterateAvailableItems walks ListAvailableItems page by page
+func (srv *StockService) IterateAvailableItems(stockID string, opts *ListStockOptions) *StringIterator {
+    return newStringIterator(opts, maxItemsLimit, func(ctx context.Context, query *ListStockOptions) ([]string, int, error) {
+        result, err := srv.ListAvailableItems(ctx, stockID, query)
+        if err != nil {
+            return nil, 0, err
+        }
+        return result.Data, result.TotalCount, nil
+    })
+}
+
+func newStringIterator(opts *ListStockOptions, maxLimit uint32,
+    list func(ctx context.Context, query *ListStockOptions) ([]string, int, error)) *StringIterator {
+    query := ListStockOptions{}
+    if opts != nil {
+        query = *opts
+    }
+    if query.Limit == 0 {
+        query.Limit = maxLimit
+    }
+    it := &StringIterator{}
+    it.Iterator = client.NewIterator(int(query.Limit), func(ctx context.Context, offset, limit int) (n, total int, err error) {
+        query.Offset = uint32(offset)
+        query.Limit = uint32(limit)
+        data, total, err := list(ctx, &query)
+        if err != nil {
+            return
+        }
+        it.data = data
+        return len(data), total, nil
+    })
+    it.PageNumbered = true
+    return it
+}
@@ -2,6 +2,7 @@ package favor
 
 import (
     "context"
+    "errors"
     "fmt"
     "net/http"
     "time"
@@ -12,10 +13,38 @@ import (
 
 type StockService client.Service
 
+const maxQueryStocksLimit = 10
+
+// StockStatus 批次状态
+type StockStatus string
+
+const (
+    StockStatusUnactivated StockStatus = "unactivated"
+    StockStatusAudit       StockStatus = "audit"
+    StockStatusRunning     StockStatus = "running"
+    StockStatusStoped      StockStatus = "stoped"
+    StockStatusPaused      StockStatus = "paused"
+)
+
+func (status StockStatus) Valid() bool {
+    switch status {
+    case StockStatusUnactivated, StockStatusAudit, StockStatusRunning, StockStatusStoped, StockStatusPaused:
+        return true
+    }
+    return false
+}
+
+var chinaZone = time.FixedZone("CST", 8*60*60)
+
+func inChina(t time.Time) time.Time {
+    if t.IsZero() {
+        return t
+    }
+    return t.In(chinaZone)
+}
+
 // Stock represents a Wechat merchant stock
 type Stock struct {
-    Code               string    `json:"code,omitempty"`
-    Message            string    `json:"message,omitempty"`
     StockId            string    `json:"stock_id"`
     StockName          string    `json:"stock_name"`
     Comment            string    `json:"comment"`
@@ -36,14 +65,14 @@ type Stock struct {
         MerchantLogo    string `json:"merchant_logo"`
         MerchantName    string `json:"merchant_name"`
         BackgroundColor string `json:"background_color"`
-        CouponImage     string `json:"coupon_image "`
+        CouponImage     string `json:"coupon_image"`
     } `json:"pattern_info"`
     CouponUseRule *struct {
         CouponAvailableTime *struct {
             FixAvailableTime *struct {
-                AvailableWeekDay []int `json:"available_week_day "`
-                BeginTime        int   `json:"begin_time "`
-                EndTime          int   `json:"end_time "`
+                AvailableWeekDay []int `json:"available_week_day"`
+                BeginTime        int   `json:"begin_time"`
+                EndTime          int   `json:"end_time"`
             } `json:"fix_available_time"`
             SecondDayAvailable        bool `json:"second_day_available"`
             AvailableTimeAfterReceive int  `json:"available_time_after_receive"`
@@ -51,7 +80,7 @@ type Stock struct {
         FixedNormalCoupon *struct {
             CouponAmount       int `json:"coupon_amount"`
             TransactionMinimum int `json:"transaction_minimum"`
-        } `json:" fixed_normal_coupon "`
+        } `json:"fixed_normal_coupon"`
         DisscountCoupon *struct {
             DiscountAmountMax  int `json:"discount_amount_max"`
             DiscountPercent    int `json:"discount_percent"`
@@ -75,9 +104,10 @@ type Stock struct {
         SinglePriceMax int64 `json:"single_price_max"`
         CutToPrice     int64 `json:"cut_to_price"`
     } `json:"cut_to_message"`
-    Singleitem   bool   `json:"singleitem"`
-    StockType    string `json:"stock_type"`
-    OutRequestNo string `json:"out_request_no"`
+    Singleitem   bool        `json:"singleitem"`
+    StockType    string      `json:"stock_type"`
+    Status       StockStatus `json:"status,omitempty"`
+    OutRequestNo string      `json:"out_request_no"`
 }
 
 func (stock *Stock) String() string {
@@ -91,14 +121,17 @@ type CreatorMchOptions struct {
 type CreateStockResponse struct {
     StockID    string    `json:"stock_id"`
     CreateTime time.Time `json:"create_time"`
-    client.ErrorMessage
 }
 
 // CreateStock-创建代金券批次
 // https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/marketing/convention/chapter3_1.shtml
 // 通过此接口可创建代金券批次，包括预充值&免充值类型
-func (srv *StockService) CreateStock(ctx context.Context, stock *Stock) (result *CreateStockResponse, err error) {
-    request, err := srv.Client.NewRequest(http.MethodPost, "marketing/favor/coupon-stocks", stock)
+// 请求使用NewFixedNormalStock、NewDiscountStock或NewExchangeStock构建，发送前会在本地校验
+func (srv *StockService) CreateStock(ctx context.Context, stock *CreateStockRequest) (result *CreateStockResponse, err error) {
+    if err = stock.Validate(); err != nil {
+        return
+    }
+    request, err := srv.Client.NewRequest(ctx, http.MethodPost, "marketing/favor/coupon-stocks", stock)
     if err != nil {
         return
     }
@@ -109,31 +142,22 @@ func (srv *StockService) CreateStock(ctx context.Context, stock *Stock) (result
     return
 }
 
+type CreatorMchRequest struct {
+    StockCreatorMchid string `json:"stock_creator_mchid"`
+}
+
 type ActivateStockResponse struct {
-    StartTime string `json:"start_time"`
-    StockID   string `json:"stock_id"`
+    StartTime time.Time `json:"start_time"`
+    StockID   string    `json:"stock_id"`
 }
 
 // ActivateStock 激活代金券批次
 // https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/marketing/convention/chapter3_3.shtml
 // 制券成功后，可调用此接口激活代金券批次
 func (srv *StockService) ActivateStock(ctx context.Context, stockCreatorMchId, stockID string) (
-result *ActivateStockResponse, err error) {
-    opt := &CreatorMchOptions{StockCreatorMchid: stockCreatorMchId}
-    path := fmt.Sprintf("marketing/favor/stocks/%s/start", stockID)
-    rawurl, err := client.AddOptions(path, opt)
-    if err != nil {
-        return
-    }
-
-    req, err := srv.Client.NewRequest(http.MethodGet, rawurl, nil)
-    if err != nil {
-        return
-    }
-
+    result *ActivateStockResponse, err error) {
     result = &ActivateStockResponse{}
-    err = srv.Client.Do(req, result)
-    if err != nil {
+    if err = srv.lifecycle(ctx, stockCreatorMchId, stockID, "start", result); err != nil {
         return
     }
 
@@ -141,67 +165,75 @@ result *ActivateStockResponse, err error) {
 }
 
 type PauseStockResponse struct {
-    PauseTime string `json:"pause_time"`
-    StockID   string `json:"stock_id"`
+    PauseTime time.Time `json:"pause_time"`
+    StockID   string    `json:"stock_id"`
 }
 
 // PauseStock 暂停代金券批次
 // https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/marketing/convention/chapter3_13.shtml
 // 通过此接口可暂停指定代金券批次。暂停后，该代金券批次暂停发放。
-func (srv *StockService) PauseStock(stockCreatorMchId, stockID string) (result *PauseStockResponse, err error) {
-    opt := &CreatorMchOptions{StockCreatorMchid: stockCreatorMchId}
-    path := fmt.Sprintf("marketing/favor/stocks/%s/pause", stockID)
-    rawurl, err := client.AddOptions(path, opt)
-    if err != nil {
-        return
-    }
-
-    req, err := srv.Client.NewRequest(http.MethodGet, rawurl, nil)
-    if err != nil {
-        return
-    }
-
+func (srv *StockService) PauseStock(ctx context.Context, stockCreatorMchId, stockID string) (result *PauseStockResponse, err error) {
     result = &PauseStockResponse{}
-    err = srv.Client.Do(req, result)
-    if err != nil {
+    if err = srv.lifecycle(ctx, stockCreatorMchId, stockID, "pause", result); err != nil {
         return
     }
 
     return
 }
 
+type RestartStockResponse struct {
+    RestartTime time.Time `json:"restart_time"`
+    StockID     string    `json:"stock_id"`
+}
+
 // RestartStock 重启代金券批次
 // https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/marketing/convention/chapter3_14.shtml
 // 通过此接口可重启指定代金券批次。重启后，该代金券批次可以再次发放。
-func (srv *StockService) RestartStock(stockCreatorMchId, stockID string) (result *PauseStockResponse, err error) {
-    opt := &CreatorMchOptions{StockCreatorMchid: stockCreatorMchId}
-    path := fmt.Sprintf("marketing/favor/stocks/%s/pause", stockID)
-    rawurl, err := client.AddOptions(path, opt)
-    if err != nil {
+func (srv *StockService) RestartStock(ctx context.Context, stockCreatorMchId, stockID string) (result *RestartStockResponse, err error) {
+    result = &RestartStockResponse{}
+    if err = srv.lifecycle(ctx, stockCreatorMchId, stockID, "restart", result); err != nil {
         return
     }
 
-    req, err := srv.Client.NewRequest(http.MethodGet, rawurl, nil)
-    if err != nil {
-        return
-    }
+    return
+}
 
-    result = &PauseStockResponse{}
-    err = srv.Client.Do(req, result)
+func (srv *StockService) lifecycle(ctx context.Context, stockCreatorMchId, stockID, action string, result interface{}) (err error) {
+    path := fmt.Sprintf("marketing/favor/stocks/%s/%s", stockID, action)
+    req, err := srv.Client.NewRequest(ctx, http.MethodPost, path, &CreatorMchRequest{StockCreatorMchid: stockCreatorMchId})
     if err != nil {
         return
     }
 
-    return
+    return srv.Client.Do(req, result)
 }
 
 type QueryStocksOptions struct {
-    Offset            uint32 `url:"offset"`
-    Limit             uint32 `url:"limit"`
-    StockCreatorMchid string `url:"stock_creator_mchid"`
-    CreateStartTime   string `url:"create_start_time"`
-    CreateEndTime     string `url:"create_end_time"`
-    Status            string `url:"status"`
+    // Offset 页码从0开始
+    Offset uint32 `url:"offset"`
+    // Limit 分页大小，最大10，为0时取10
+    Limit             uint32      `url:"limit"`
+    StockCreatorMchid string      `url:"stock_creator_mchid"`
+    CreateStartTime   time.Time   `url:"create_start_time,omitempty"`
+    CreateEndTime     time.Time   `url:"create_end_time,omitempty"`
+    Status            StockStatus `url:"status,omitempty"`
+}
+
+// Validate checks the options before sending them
+func (opts *QueryStocksOptions) Validate() error {
+    if opts.StockCreatorMchid == "" {
+        return errors.New("wxpay: stock_creator_mchid is required")
+    }
+    if opts.Limit > maxQueryStocksLimit {
+        return fmt.Errorf("wxpay: limit %d exceeds %d", opts.Limit, maxQueryStocksLimit)
+    }
+    if !opts.CreateStartTime.IsZero() && !opts.CreateEndTime.IsZero() && opts.CreateEndTime.Before(opts.CreateStartTime) {
+        return errors.New("wxpay: create_end_time is before create_start_time")
+    }
+    if opts.Status != "" && !opts.Status.Valid() {
+        return fmt.Errorf("wxpay: invalid stock status %q", opts.Status)
+    }
+    return nil
 }
 
 type QueryStocksResponse struct {
@@ -211,8 +243,28 @@ type QueryStocksResponse struct {
     Offset     int      `json:"offset"`
 }
 
-func (srv *StockService) QueryStocks(opts *QueryStocksOptions) (result *QueryStocksResponse, err error) {
-    req, err := srv.Client.NewRequest(http.MethodGet, "marketing/favor/stocks", nil)
+// QueryStocks 条件查询批次列表
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/marketing/convention/chapter3_4.shtml
+func (srv *StockService) QueryStocks(ctx context.Context, opts *QueryStocksOptions) (result *QueryStocksResponse, err error) {
+    if opts == nil {
+        return nil, errors.New("wxpay: QueryStocksOptions is required")
+    }
+    if err = opts.Validate(); err != nil {
+        return
+    }
+    query := *opts
+    if query.Limit == 0 {
+        query.Limit = maxQueryStocksLimit
+    }
+    // RFC3339 in the +08:00 offset the API documents
+    query.CreateStartTime = inChina(query.CreateStartTime)
+    query.CreateEndTime = inChina(query.CreateEndTime)
+
+    rawurl, err := client.AddOptions("marketing/favor/stocks", &query)
+    if err != nil {
+        return
+    }
+    req, err := srv.Client.NewRequest(ctx, http.MethodGet, rawurl, nil)
     if err != nil {
         return
     }
@@ -226,7 +278,47 @@ func (srv *StockService) QueryStocks(opts *QueryStocksOptions) (result *QuerySto
     return
 }
 
-func (srv *StockService) GetStock(stockCreatorMchId, stockID string) (result *Stock, err error) {
+// StockIterator iterates the pages of QueryStocks
+type StockIterator struct {
+    *client.Iterator
+    stocks []*Stock
+}
+
+// Stocks returns the stocks of the current page
+func (it *StockIterator) Stocks() []*Stock {
+    return it.stocks
+}
+
+// All reads the remaining pages
+func (it *StockIterator) All(ctx context.Context) (stocks []*Stock, err error) {
+    for it.Next(ctx) {
+        stocks = append(stocks, it.stocks...)
+    }
+    return stocks, it.Err()
+}
+
+// IterateStocks walks QueryStocks page by page, opts.Limit is the page size
+func (srv *StockService) IterateStocks(opts *QueryStocksOptions) *StockIterator {
+    query := QueryStocksOptions{}
+    if opts != nil {
+        query = *opts
+    }
+    it := &StockIterator{}
+    it.Iterator = client.NewIterator(int(query.Limit), func(ctx context.Context, offset, limit int) (n, total int, err error) {
+        query.Offset = uint32(offset)
+        query.Limit = uint32(limit)
+        result, err := srv.QueryStocks(ctx, &query)
+        if err != nil {
+            return
+        }
+        it.stocks = result.Data
+        return len(result.Data), result.TotalCount, nil
+    })
+    it.PageNumbered = true
+    return it
+}
+
+func (srv *StockService) GetStock(ctx context.Context, stockCreatorMchId, stockID string) (result *Stock, err error) {
     opt := &CreatorMchOptions{StockCreatorMchid: stockCreatorMchId}
     path := fmt.Sprintf("marketing/favor/stocks/%s", stockID)
     rawurl, err := client.AddOptions(path, opt)
@@ -234,7 +326,7 @@ func (srv *StockService) GetStock(stockCreatorMchId, stockID string) (result *St
         return
     }
 
-    req, err := srv.Client.NewRequest(http.MethodGet, rawurl, nil)
+    req, err := srv.Client.NewRequest(ctx, http.MethodGet, rawurl, nil)
     if err != nil {
         return
     }
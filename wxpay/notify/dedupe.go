@@ -0,0 +1,154 @@
+package notify
+
+import (
+    "container/list"
+    "context"
+    "database/sql"
+    "fmt"
+    "strings"
+    "sync"
+    "time"
+)
+
+// 微信支付最多重发 15 次通知，历时约 24 小时
+const defaultDedupeTTL = 48 * time.Hour
+
+// DedupeStore remembers the ids of processed notifications.
+// A notification is marked only after its handler succeeded, so it is processed at least once.
+type DedupeStore interface {
+    Processed(ctx context.Context, id string) (bool, error)
+    MarkProcessed(ctx context.Context, id string) error
+}
+
+// MemoryStore keeps processed ids in memory for TTL
+type MemoryStore struct {
+    TTL time.Duration
+
+    mu  sync.Mutex
+    ids map[string]time.Time
+    // marks lists the marks in order, so in expiry order, to sweep the expired ids from the front
+    marks *list.List
+}
+
+type mark struct {
+    id     string
+    expire time.Time
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+    if ttl <= 0 {
+        ttl = defaultDedupeTTL
+    }
+    return &MemoryStore{TTL: ttl, ids: make(map[string]time.Time), marks: list.New()}
+}
+
+func (s *MemoryStore) Processed(ctx context.Context, id string) (bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    expire, ok := s.ids[id]
+    if ok && time.Now().After(expire) {
+        delete(s.ids, id)
+        return false, nil
+    }
+    return ok, nil
+}
+
+func (s *MemoryStore) MarkProcessed(ctx context.Context, id string) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    now := time.Now()
+    for e := s.marks.Front(); e != nil; e = s.marks.Front() {
+        m := e.Value.(*mark)
+        if !now.After(m.expire) {
+            break
+        }
+        s.marks.Remove(e)
+        // the id may have been marked again since
+        if s.ids[m.id].Equal(m.expire) {
+            delete(s.ids, m.id)
+        }
+    }
+    expire := now.Add(s.TTL)
+    s.ids[id] = expire
+    s.marks.PushBack(&mark{id: id, expire: expire})
+    return nil
+}
+
+// SQLStore keeps processed ids in a database/sql table, e.g. SQLite or MySQL
+type SQLStore struct {
+    db    *sql.DB
+    table string
+
+    // Placeholder formats the n-th bind parameter, "?" by default, use "$n" for PostgreSQL
+    Placeholder func(n int) string
+}
+
+func NewSQLStore(db *sql.DB, table string) *SQLStore {
+    if table == "" {
+        table = "wxpay_notifications"
+    }
+    return &SQLStore{
+        db:          db,
+        table:       table,
+        Placeholder: func(n int) string { return "?" },
+    }
+}
+
+// CreateTable creates the table if it does not exist
+func (s *SQLStore) CreateTable(ctx context.Context) (err error) {
+    _, err = s.db.ExecContext(ctx, fmt.Sprintf(
+        "CREATE TABLE IF NOT EXISTS %s (id VARCHAR(64) NOT NULL PRIMARY KEY, processed_at TIMESTAMP NOT NULL)", s.table))
+    return
+}
+
+func (s *SQLStore) Processed(ctx context.Context, id string) (ok bool, err error) {
+    var n int
+    err = s.db.QueryRowContext(ctx,
+        fmt.Sprintf("SELECT 1 FROM %s WHERE id = %s", s.table, s.Placeholder(1)), id).Scan(&n)
+    if err == sql.ErrNoRows {
+        return false, nil
+    }
+    if err != nil {
+        return
+    }
+    return true, nil
+}
+
+func (s *SQLStore) MarkProcessed(ctx context.Context, id string) (err error) {
+    _, err = s.db.ExecContext(ctx,
+        fmt.Sprintf("INSERT INTO %s (id, processed_at) VALUES (%s, %s)", s.table, s.Placeholder(1), s.Placeholder(2)),
+        id, time.Now().UTC())
+    if err == nil {
+        return
+    }
+    // a concurrent delivery of the same notification may have been marked first
+    if ok, _ := s.Processed(ctx, id); ok {
+        return nil
+    }
+    return
+}
+
+// Purge deletes the ids processed before the given time
+func (s *SQLStore) Purge(ctx context.Context, before time.Time) (err error) {
+    _, err = s.db.ExecContext(ctx,
+        fmt.Sprintf("DELETE FROM %s WHERE processed_at < %s", s.table, s.Placeholder(1)), before.UTC())
+    return
+}
+
+// dedupe wraps handler so that processed notifications are acknowledged without calling it again
+func dedupe(store DedupeStore, handler HandlerFunc) HandlerFunc {
+    return func(ctx context.Context, n *Notification) (err error) {
+        id := strings.TrimSpace(n.ID)
+        if id == "" {
+            return handler(ctx, n)
+        }
+        processed, err := store.Processed(ctx, id)
+        if err != nil || processed {
+            return
+        }
+        if err = handler(ctx, n); err != nil {
+            return
+        }
+        return store.MarkProcessed(ctx, id)
+    }
+}
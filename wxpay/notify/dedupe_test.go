@@ -0,0 +1,81 @@
+package notify
+
+import (
+    "context"
+    "errors"
+    "testing"
+    "time"
+)
+
+func TestMemoryStoreExpires(t *testing.T) {
+    store := NewMemoryStore(50 * time.Millisecond)
+    ctx := context.Background()
+    if err := store.MarkProcessed(ctx, "n1"); err != nil {
+        t.Fatal(err)
+    }
+    if ok, _ := store.Processed(ctx, "n1"); !ok {
+        t.Fatal("n1 not processed after marking")
+    }
+    time.Sleep(100 * time.Millisecond)
+    if ok, _ := store.Processed(ctx, "n1"); ok {
+        t.Error("n1 still processed after its TTL")
+    }
+}
+
+func TestDedupeMarksAfterSuccess(t *testing.T) {
+    store := NewMemoryStore(time.Hour)
+    ctx := context.Background()
+    calls := 0
+    fail := true
+    handler := dedupe(store, func(ctx context.Context, n *Notification) error {
+        calls++
+        if fail {
+            return errors.New("database down")
+        }
+        return nil
+    })
+    n := &Notification{ID: "n1"}
+
+    if err := handler(ctx, n); err == nil {
+        t.Fatal("failing handler succeeded")
+    }
+    if ok, _ := store.Processed(ctx, "n1"); ok {
+        t.Fatal("n1 marked although its handler failed")
+    }
+
+    fail = false
+    if err := handler(ctx, n); err != nil {
+        t.Fatal(err)
+    }
+    if ok, _ := store.Processed(ctx, "n1"); !ok {
+        t.Fatal("n1 not marked after its handler succeeded")
+    }
+
+    // the redelivery is acknowledged without calling the handler
+    if err := handler(ctx, n); err != nil {
+        t.Fatal(err)
+    }
+    if calls != 2 {
+        t.Errorf("handler called %d times, want 2", calls)
+    }
+}
+
+func TestMemoryStoreSweepsExpired(t *testing.T) {
+    store := NewMemoryStore(50 * time.Millisecond)
+    ctx := context.Background()
+    for _, id := range []string{"n1", "n2", "n3"} {
+        if err := store.MarkProcessed(ctx, id); err != nil {
+            t.Fatal(err)
+        }
+    }
+    time.Sleep(100 * time.Millisecond)
+    // marked again, n2 outlives its first mark
+    store.MarkProcessed(ctx, "n2")
+    store.MarkProcessed(ctx, "n4")
+    if n := len(store.ids); n != 2 {
+        t.Fatalf("%d ids kept, want n2 and n4", n)
+    }
+    if ok, _ := store.Processed(ctx, "n2"); !ok {
+        t.Error("n2 swept although marked again")
+    }
+}
@@ -0,0 +1,130 @@
+package notify
+
+import (
+    "time"
+)
+
+// Transaction 支付成功通知
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter3_1_5.shtml
+type Transaction struct {
+    Appid          string    `json:"appid"`
+    Mchid          string    `json:"mchid"`
+    OutTradeNo     string    `json:"out_trade_no"`
+    TransactionID  string    `json:"transaction_id"`
+    TradeType      string    `json:"trade_type"`
+    TradeState     string    `json:"trade_state"`
+    TradeStateDesc string    `json:"trade_state_desc"`
+    BankType       string    `json:"bank_type"`
+    Attach         string    `json:"attach"`
+    SuccessTime    time.Time `json:"success_time"`
+    Payer          *struct {
+        Openid string `json:"openid"`
+    } `json:"payer"`
+    Amount *struct {
+        Total         int64  `json:"total"`
+        PayerTotal    int64  `json:"payer_total"`
+        Currency      string `json:"currency"`
+        PayerCurrency string `json:"payer_currency"`
+    } `json:"amount"`
+    SceneInfo *struct {
+        DeviceID string `json:"device_id"`
+    } `json:"scene_info"`
+    PromotionDetail []*struct {
+        CouponID            string `json:"coupon_id"`
+        Name                string `json:"name"`
+        Scope               string `json:"scope"`
+        Type                string `json:"type"`
+        Amount              int64  `json:"amount"`
+        StockID             string `json:"stock_id"`
+        WechatpayContribute int64  `json:"wechatpay_contribute"`
+        MerchantContribute  int64  `json:"merchant_contribute"`
+        OtherContribute     int64  `json:"other_contribute"`
+        Currency            string `json:"currency"`
+        GoodsDetail         []*struct {
+            GoodsID        string `json:"goods_id"`
+            Quantity       int    `json:"quantity"`
+            UnitPrice      int64  `json:"unit_price"`
+            DiscountAmount int64  `json:"discount_amount"`
+            GoodsRemark    string `json:"goods_remark"`
+        } `json:"goods_detail"`
+    } `json:"promotion_detail"`
+}
+
+// Refund 退款结果通知
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter3_1_11.shtml
+type Refund struct {
+    Mchid               string    `json:"mchid"`
+    TransactionID       string    `json:"transaction_id"`
+    OutTradeNo          string    `json:"out_trade_no"`
+    RefundID            string    `json:"refund_id"`
+    OutRefundNo         string    `json:"out_refund_no"`
+    RefundStatus        string    `json:"refund_status"`
+    SuccessTime         time.Time `json:"success_time"`
+    UserReceivedAccount string    `json:"user_received_account"`
+    Amount              *struct {
+        Total       int64 `json:"total"`
+        Refund      int64 `json:"refund"`
+        PayerTotal  int64 `json:"payer_total"`
+        PayerRefund int64 `json:"payer_refund"`
+    } `json:"amount"`
+}
+
+// PayscorePermission 开启/解除授权服务回调通知
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/payscore/chapter5_6.shtml
+type PayscorePermission struct {
+    Appid             string `json:"appid"`
+    Mchid             string `json:"mchid"`
+    OutRequestNo      string `json:"out_request_no"`
+    ServiceID         string `json:"service_id"`
+    Openid            string `json:"openid"`
+    UserServiceStatus string `json:"user_service_status"`
+    OpenOrCloseTime   string `json:"openorclose_time"`
+    AuthorizationCode string `json:"authorization_code"`
+}
+
+// PayscoreOrder 确认订单/支付成功回调通知
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/payscore/chapter5_7.shtml
+type PayscoreOrder struct {
+    Appid               string `json:"appid"`
+    Mchid               string `json:"mchid"`
+    OutOrderNo          string `json:"out_order_no"`
+    ServiceID           string `json:"service_id"`
+    Openid              string `json:"openid"`
+    State               string `json:"state"`
+    StateDescription    string `json:"state_description"`
+    TotalAmount         int64  `json:"total_amount"`
+    ServiceIntroduction string `json:"service_introduction"`
+    OrderID             string `json:"order_id"`
+    NeedCollection      bool   `json:"need_collection"`
+    Collection          *struct {
+        State        string `json:"state"`
+        TotalAmount  int64  `json:"total_amount"`
+        PayingAmount int64  `json:"paying_amount"`
+        PaidAmount   int64  `json:"paid_amount"`
+        Details      []*struct {
+            Seq           int    `json:"seq"`
+            Amount        int64  `json:"amount"`
+            PaidType      string `json:"paid_type"`
+            PaidTime      string `json:"paid_time"`
+            TransactionID string `json:"transaction_id"`
+        } `json:"details"`
+    } `json:"collection"`
+}
+
+// ProfitSharing 分账动账通知
+// https://pay.weixin.qq.com/wiki/doc/apiv3/apis/chapter8_1_10.shtml
+type ProfitSharing struct {
+    Mchid         string `json:"mchid"`
+    SpMchid       string `json:"sp_mchid"`
+    SubMchid      string `json:"sub_mchid"`
+    TransactionID string `json:"transaction_id"`
+    OrderID       string `json:"order_id"`
+    OutOrderNo    string `json:"out_order_no"`
+    Receiver      *struct {
+        Type        string `json:"type"`
+        Account     string `json:"account"`
+        Amount      int64  `json:"amount"`
+        Description string `json:"description"`
+    } `json:"receiver"`
+    SuccessTime time.Time `json:"success_time"`
+}
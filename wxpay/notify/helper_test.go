@@ -0,0 +1,110 @@
+package notify
+
+import (
+    "bytes"
+    "context"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/rand"
+    "crypto/rsa"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strconv"
+    "sync"
+    "testing"
+    "time"
+
+    "github.com/yunlyz/go-wechat/wxpay/client"
+)
+
+const (
+    testAPIv3Key = "0123456789abcdef0123456789abcdef"
+    testSerialNo = "5157F09EFDC096DE15EBE81A47057A7232F1B8E1"
+)
+
+var (
+    testKeyOnce sync.Once
+    testKey     *rsa.PrivateKey
+)
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+    testKeyOnce.Do(func() {
+        key, err := rsa.GenerateKey(rand.Reader, 2048)
+        if err != nil {
+            t.Fatal(err)
+        }
+        testKey = key
+    })
+    return testKey
+}
+
+// newTestClient creates a client trusting the test key as platform key
+func newTestClient(t *testing.T, opts ...client.Option) *client.Client {
+    verifier := client.NewCertificateVerifier()
+    verifier.AddPublicKey(testSerialNo, &newTestKey(t).PublicKey)
+    opts = append([]client.Option{client.WithVerifier(verifier), client.WithAPIv3Key(testAPIv3Key)}, opts...)
+    c, err := client.NewClient(1900000001, opts...)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return c
+}
+
+// encryptResource encrypts plaintext the way WeChat Pay encrypts notification resources
+func encryptResource(t *testing.T, plaintext string) *Resource {
+    block, err := aes.NewCipher([]byte(testAPIv3Key))
+    if err != nil {
+        t.Fatal(err)
+    }
+    aead, err := cipher.NewGCM(block)
+    if err != nil {
+        t.Fatal(err)
+    }
+    nonce := "0123456789ab"
+    associatedData := "transaction"
+    ciphertext := aead.Seal(nil, []byte(nonce), []byte(plaintext), []byte(associatedData))
+    return &Resource{
+        Algorithm:      "AEAD_AES_256_GCM",
+        Ciphertext:     base64.StdEncoding.EncodeToString(ciphertext),
+        AssociatedData: associatedData,
+        Nonce:          nonce,
+    }
+}
+
+// newNotifyRequest creates a signed notification request with the given timestamp
+func newNotifyRequest(t *testing.T, n *Notification, timestamp time.Time) *http.Request {
+    body, err := json.Marshal(n)
+    if err != nil {
+        t.Fatal(err)
+    }
+    ts := strconv.FormatInt(timestamp.Unix(), 10)
+    nonce := fmt.Sprintf("nonce%d", time.Now().UnixNano())
+    signer, err := client.NewRSASignerFromKey(testSerialNo, newTestKey(t))
+    if err != nil {
+        t.Fatal(err)
+    }
+    signature, _, err := signer.Sign(context.Background(), []byte(ts+"\n"+nonce+"\n"+string(body)+"\n"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    r := httptest.NewRequest(http.MethodPost, "/wxpay/notify", bytes.NewReader(body))
+    r.Header.Set("Wechatpay-Timestamp", ts)
+    r.Header.Set("Wechatpay-Nonce", nonce)
+    r.Header.Set("Wechatpay-Signature", signature)
+    r.Header.Set("Wechatpay-Serial", testSerialNo)
+    return r
+}
+
+func newNotification(t *testing.T, id, plaintext string) *Notification {
+    return &Notification{
+        ID:           id,
+        CreateTime:   time.Now(),
+        EventType:    EventTransactionSuccess,
+        ResourceType: "encrypt-resource",
+        Summary:      "支付成功",
+        Resource:     encryptResource(t, plaintext),
+    }
+}
@@ -0,0 +1,147 @@
+package notify
+
+import (
+    "context"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "time"
+
+    "github.com/yunlyz/go-wechat/wxpay/client"
+)
+
+const (
+    codeSuccess = "SUCCESS"
+    codeFail    = "FAIL"
+    messageFail = "失败"
+
+    // maxBodySize limits the notification body read from the request
+    maxBodySize = 1 << 20
+)
+
+var ErrNoAPIv3Key = errors.New("wxpay: APIv3 key is required to decrypt notifications")
+
+// Notification 回调通知
+// https://pay.weixin.qq.com/wiki/doc/apiv3/wxpay/marketing/convention/chapter3_15.shtml
+type Notification struct {
+    ID           string    `json:"id"`
+    CreateTime   time.Time `json:"create_time"`
+    EventType    string    `json:"event_type"`
+    ResourceType string    `json:"resource_type"`
+    Summary      string    `json:"summary"`
+    Resource     *Resource `json:"resource"`
+
+    // Plaintext is the decrypted resource.ciphertext
+    Plaintext []byte `json:"-"`
+}
+
+// Resource is the encrypted business data of the notification
+type Resource struct {
+    Algorithm      string `json:"algorithm"`
+    OriginalType   string `json:"original_type"`
+    Ciphertext     string `json:"ciphertext"`
+    AssociatedData string `json:"associated_data"`
+    Nonce          string `json:"nonce"`
+}
+
+// Decode unmarshals the decrypted resource into v
+func (n *Notification) Decode(v interface{}) error {
+    return json.Unmarshal(n.Plaintext, v)
+}
+
+// Ack is the acknowledgment written back to WeChat Pay
+type Ack struct {
+    Code    string `json:"code"`
+    Message string `json:"message"`
+}
+
+// HandlerFunc processes a verified and decrypted notification,
+// returning an error makes WeChat Pay send the notification again
+type HandlerFunc func(ctx context.Context, n *Notification) error
+
+// Handler is the http.Handler of the notify url
+type Handler struct {
+    client  *client.Client
+    handler HandlerFunc
+
+    // Store skips notifications already processed when set, see MemoryStore and SQLStore
+    Store DedupeStore
+}
+
+// New creates a handler verifying notifications with c, its APIv3Key decrypts the resource
+func New(c *client.Client, handler HandlerFunc) *Handler {
+    return &Handler{client: c, handler: handler}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        writeAck(w, http.StatusMethodNotAllowed, codeFail, "method not allowed")
+        return
+    }
+    // the details of the error stay in the log, the caller only learns that it failed
+    n, err := Parse(h.client, r)
+    if err != nil {
+        h.client.Logger().Printf("wxpay: reject notification: %v", err)
+        writeAck(w, http.StatusBadRequest, codeFail, messageFail)
+        return
+    }
+    handler := h.handler
+    if h.Store != nil {
+        handler = dedupe(h.Store, handler)
+    }
+    if err = handler(r.Context(), n); err != nil {
+        h.client.Logger().Printf("wxpay: handle notification %s: %v", n.ID, err)
+        writeAck(w, http.StatusInternalServerError, codeFail, messageFail)
+        return
+    }
+    writeAck(w, http.StatusOK, codeSuccess, "成功")
+}
+
+// Parse verifies the Wechatpay-* headers of the request, decodes the notification
+// and decrypts its resource
+func Parse(c *client.Client, r *http.Request) (n *Notification, err error) {
+    body, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodySize))
+    if err != nil {
+        return
+    }
+    if err = c.Verify(r.Context(), r.Header, body); err != nil {
+        return
+    }
+
+    n = &Notification{}
+    if err = json.Unmarshal(body, n); err != nil {
+        return nil, fmt.Errorf("wxpay: decode notification: %v", err)
+    }
+    if n.Resource == nil {
+        return nil, fmt.Errorf("wxpay: notification %s has no resource", n.ID)
+    }
+    if n.Plaintext, err = Decrypt(c.APIv3Key, n.Resource); err != nil {
+        return nil, fmt.Errorf("wxpay: decrypt notification %s: %v", n.ID, err)
+    }
+    return
+}
+
+// Decrypt decrypts the AEAD_AES_256_GCM encrypted resource with the APIv3 key
+func Decrypt(apiV3Key string, resource *Resource) (plaintext []byte, err error) {
+    if apiV3Key == "" {
+        return nil, ErrNoAPIv3Key
+    }
+    ciphertext, err := base64.StdEncoding.DecodeString(resource.Ciphertext)
+    if err != nil {
+        return
+    }
+    text, err := client.CertificateDecrypt(ciphertext, apiV3Key, resource.Nonce, resource.AssociatedData)
+    if err != nil {
+        return
+    }
+    return []byte(text), nil
+}
+
+func writeAck(w http.ResponseWriter, status int, code, message string) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(status)
+    _ = json.NewEncoder(w).Encode(&Ack{Code: code, Message: message})
+}
@@ -0,0 +1,116 @@
+package notify
+
+import (
+    "context"
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+    "time"
+
+    "github.com/yunlyz/go-wechat/wxpay/client"
+)
+
+func serve(t *testing.T, h http.Handler, r *http.Request) (status int, ack *Ack) {
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, r)
+    ack = &Ack{}
+    if err := json.Unmarshal(w.Body.Bytes(), ack); err != nil {
+        t.Fatalf("ack body %q: %v", w.Body.String(), err)
+    }
+    return w.Code, ack
+}
+
+// captureLogger keeps the logged lines
+type captureLogger struct {
+    lines []string
+}
+
+func (l *captureLogger) Printf(format string, v ...interface{}) {
+    l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func (l *captureLogger) contains(s string) bool {
+    for _, line := range l.lines {
+        if strings.Contains(line, s) {
+            return true
+        }
+    }
+    return false
+}
+
+func TestHandlerDecryptsNotification(t *testing.T) {
+    var got *Transaction
+    h := New(newTestClient(t), func(ctx context.Context, n *Notification) error {
+        got = &Transaction{}
+        return n.Decode(got)
+    })
+    r := newNotifyRequest(t, newNotification(t, "n1", `{"out_trade_no":"T1","trade_state":"SUCCESS"}`), time.Now())
+
+    status, ack := serve(t, h, r)
+    if status != http.StatusOK || ack.Code != codeSuccess || ack.Message != "成功" {
+        t.Errorf("ack %d %+v, want 200 SUCCESS", status, ack)
+    }
+    if got == nil || got.OutTradeNo != "T1" || got.TradeState != "SUCCESS" {
+        t.Errorf("decoded %+v", got)
+    }
+}
+
+func TestHandlerRejectsBadSignature(t *testing.T) {
+    called := false
+    h := New(newTestClient(t), func(ctx context.Context, n *Notification) error {
+        called = true
+        return nil
+    })
+    r := newNotifyRequest(t, newNotification(t, "n1", `{}`), time.Now())
+    r.Header.Set("Wechatpay-Signature", base64Of("forged"))
+
+    status, ack := serve(t, h, r)
+    if status != http.StatusBadRequest || ack.Code != codeFail {
+        t.Errorf("ack %d %+v, want 400 FAIL", status, ack)
+    }
+    if called {
+        t.Error("handler called for a forged notification")
+    }
+}
+
+func TestHandlerRejectsSkewedTimestamp(t *testing.T) {
+    logger := &captureLogger{}
+    h := New(newTestClient(t, client.WithLogger(logger)), func(ctx context.Context, n *Notification) error {
+        return nil
+    })
+    r := newNotifyRequest(t, newNotification(t, "n1", `{}`), time.Now().Add(-time.Hour))
+
+    status, ack := serve(t, h, r)
+    if status != http.StatusBadRequest || ack.Code != codeFail || ack.Message != messageFail {
+        t.Errorf("ack %d %+v, want 400 FAIL", status, ack)
+    }
+    if !logger.contains("clock skew") {
+        t.Errorf("clock skew not logged: %q", logger.lines)
+    }
+}
+
+func TestHandlerFailsWhenHandlerFails(t *testing.T) {
+    logger := &captureLogger{}
+    h := New(newTestClient(t, client.WithLogger(logger)), func(ctx context.Context, n *Notification) error {
+        return errors.New("database down")
+    })
+    r := newNotifyRequest(t, newNotification(t, "n1", `{}`), time.Now())
+
+    // the error of the handler is logged, not written back
+    status, ack := serve(t, h, r)
+    if status != http.StatusInternalServerError || ack.Code != codeFail || ack.Message != messageFail {
+        t.Errorf("ack %d %+v, want 500 FAIL", status, ack)
+    }
+    if !logger.contains("database down") {
+        t.Errorf("handler error not logged: %q", logger.lines)
+    }
+}
+
+func base64Of(s string) string {
+    return base64.StdEncoding.EncodeToString([]byte(s))
+}
@@ -0,0 +1,140 @@
+package notify
+
+import (
+    "context"
+    "fmt"
+    "sync"
+
+    "github.com/yunlyz/go-wechat/wxpay/marketing/favor"
+)
+
+// 通知类型
+const (
+    EventCouponUse                = "COUPON.USE"
+    EventTransactionSuccess       = "TRANSACTION.SUCCESS"
+    EventRefundSuccess            = "REFUND.SUCCESS"
+    EventRefundAbnormal           = "REFUND.ABNORMAL"
+    EventRefundClosed             = "REFUND.CLOSED"
+    EventPayscoreUserOpenService  = "PAYSCORE.USER_OPEN_SERVICE"
+    EventPayscoreUserCloseService = "PAYSCORE.USER_CLOSE_SERVICE"
+    EventPayscoreUserConfirm      = "PAYSCORE.USER_CONFIRM"
+    EventPayscoreUserPaid         = "PAYSCORE.USER_PAID"
+    EventProfitSharing            = "PROFITSHARING"
+)
+
+// Router dispatches notifications to the handler registered for their event_type
+//
+//	router := notify.NewRouter()
+//	router.OnCouponUse(func(ctx context.Context, n *notify.Notification, event *favor.CouponUseEvent) error { ... })
+//	http.Handle("/wxpay/notify", pay.NotifyHandler(router.Dispatch))
+type Router struct {
+    mu       sync.RWMutex
+    handlers map[string]HandlerFunc
+    fallback HandlerFunc
+}
+
+func NewRouter() *Router {
+    return &Router{handlers: make(map[string]HandlerFunc)}
+}
+
+// Handle registers the handler of an event type
+func (r *Router) Handle(eventType string, handler HandlerFunc) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.handlers[eventType] = handler
+}
+
+// Fallback registers the handler of event types without their own handler
+func (r *Router) Fallback(handler HandlerFunc) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.fallback = handler
+}
+
+// Dispatch is the HandlerFunc of the router, notifications without handler fail
+// so that WeChat Pay sends them again
+func (r *Router) Dispatch(ctx context.Context, n *Notification) error {
+    r.mu.RLock()
+    handler, ok := r.handlers[n.EventType]
+    if !ok {
+        handler = r.fallback
+    }
+    r.mu.RUnlock()
+    if handler == nil {
+        return fmt.Errorf("wxpay: no handler for event type %s", n.EventType)
+    }
+    return handler(ctx, n)
+}
+
+// OnCouponUse 代金券核销事件
+func (r *Router) OnCouponUse(handler func(ctx context.Context, n *Notification, event *favor.CouponUseEvent) error) {
+    r.Handle(EventCouponUse, func(ctx context.Context, n *Notification) error {
+        event := &favor.CouponUseEvent{}
+        if err := n.Decode(event); err != nil {
+            return err
+        }
+        return handler(ctx, n, event)
+    })
+}
+
+// OnTransactionSuccess 支付成功通知
+func (r *Router) OnTransactionSuccess(handler func(ctx context.Context, n *Notification, transaction *Transaction) error) {
+    r.Handle(EventTransactionSuccess, func(ctx context.Context, n *Notification) error {
+        transaction := &Transaction{}
+        if err := n.Decode(transaction); err != nil {
+            return err
+        }
+        return handler(ctx, n, transaction)
+    })
+}
+
+// OnRefund 退款结果通知，REFUND.SUCCESS、REFUND.ABNORMAL 和 REFUND.CLOSED 共用
+func (r *Router) OnRefund(handler func(ctx context.Context, n *Notification, refund *Refund) error) {
+    fn := func(ctx context.Context, n *Notification) error {
+        refund := &Refund{}
+        if err := n.Decode(refund); err != nil {
+            return err
+        }
+        return handler(ctx, n, refund)
+    }
+    r.Handle(EventRefundSuccess, fn)
+    r.Handle(EventRefundAbnormal, fn)
+    r.Handle(EventRefundClosed, fn)
+}
+
+// OnPayscorePermission 支付分开启/解除授权服务通知
+func (r *Router) OnPayscorePermission(handler func(ctx context.Context, n *Notification, permission *PayscorePermission) error) {
+    fn := func(ctx context.Context, n *Notification) error {
+        permission := &PayscorePermission{}
+        if err := n.Decode(permission); err != nil {
+            return err
+        }
+        return handler(ctx, n, permission)
+    }
+    r.Handle(EventPayscoreUserOpenService, fn)
+    r.Handle(EventPayscoreUserCloseService, fn)
+}
+
+// OnPayscoreOrder 支付分确认订单/支付成功通知
+func (r *Router) OnPayscoreOrder(handler func(ctx context.Context, n *Notification, order *PayscoreOrder) error) {
+    fn := func(ctx context.Context, n *Notification) error {
+        order := &PayscoreOrder{}
+        if err := n.Decode(order); err != nil {
+            return err
+        }
+        return handler(ctx, n, order)
+    }
+    r.Handle(EventPayscoreUserConfirm, fn)
+    r.Handle(EventPayscoreUserPaid, fn)
+}
+
+// OnProfitSharing 分账动账通知
+func (r *Router) OnProfitSharing(handler func(ctx context.Context, n *Notification, sharing *ProfitSharing) error) {
+    r.Handle(EventProfitSharing, func(ctx context.Context, n *Notification) error {
+        sharing := &ProfitSharing{}
+        if err := n.Decode(sharing); err != nil {
+            return err
+        }
+        return handler(ctx, n, sharing)
+    })
+}
@@ -0,0 +1,3 @@
+// Package sqlitetest runs the tests of notify.SQLStore against SQLite.
+// It is a module of its own so that go-wechat does not require the cgo driver.
+package sqlitetest
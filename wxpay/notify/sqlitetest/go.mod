@@ -0,0 +1,10 @@
+module github.com/yunlyz/go-wechat/wxpay/notify/sqlitetest
+
+go 1.13
+
+require (
+	github.com/mattn/go-sqlite3 v1.14.6
+	github.com/yunlyz/go-wechat v0.0.0
+)
+
+replace github.com/yunlyz/go-wechat => ../../..
@@ -0,0 +1,98 @@
+package sqlitetest
+
+import (
+    "context"
+    "database/sql"
+    "io/ioutil"
+    "os"
+    "path/filepath"
+    "sync"
+    "testing"
+    "time"
+
+    _ "github.com/mattn/go-sqlite3"
+    "github.com/yunlyz/go-wechat/wxpay/notify"
+)
+
+func newSQLiteStore(t *testing.T) (store *notify.SQLStore, cleanup func()) {
+    dir, err := ioutil.TempDir("", "wxpay")
+    if err != nil {
+        t.Fatal(err)
+    }
+    db, err := sql.Open("sqlite3", filepath.Join(dir, "notify.db")+"?_busy_timeout=5000")
+    if err != nil {
+        t.Fatal(err)
+    }
+    store = notify.NewSQLStore(db, "")
+    if err = store.CreateTable(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    // creating the table twice is harmless
+    if err = store.CreateTable(context.Background()); err != nil {
+        t.Fatal(err)
+    }
+    return store, func() {
+        db.Close()
+        os.RemoveAll(dir)
+    }
+}
+
+func TestSQLStore(t *testing.T) {
+    store, cleanup := newSQLiteStore(t)
+    defer cleanup()
+    ctx := context.Background()
+
+    if ok, err := store.Processed(ctx, "n1"); err != nil || ok {
+        t.Fatalf("Processed(n1) = %v, %v before marking", ok, err)
+    }
+    if err := store.MarkProcessed(ctx, "n1"); err != nil {
+        t.Fatal(err)
+    }
+    if ok, err := store.Processed(ctx, "n1"); err != nil || !ok {
+        t.Fatalf("Processed(n1) = %v, %v after marking", ok, err)
+    }
+    if ok, _ := store.Processed(ctx, "n2"); ok {
+        t.Error("n2 processed without being marked")
+    }
+
+    // purging before the mark keeps it, purging after removes it
+    if err := store.Purge(ctx, time.Now().Add(-time.Hour)); err != nil {
+        t.Fatal(err)
+    }
+    if ok, _ := store.Processed(ctx, "n1"); !ok {
+        t.Error("n1 purged before its time")
+    }
+    if err := store.Purge(ctx, time.Now().Add(time.Second)); err != nil {
+        t.Fatal(err)
+    }
+    if ok, _ := store.Processed(ctx, "n1"); ok {
+        t.Error("n1 still processed after purge")
+    }
+}
+
+func TestSQLStoreConcurrentDuplicate(t *testing.T) {
+    store, cleanup := newSQLiteStore(t)
+    defer cleanup()
+    ctx := context.Background()
+
+    // two deliveries of the same notification racing each other both succeed
+    var wg sync.WaitGroup
+    errs := make(chan error, 8)
+    for i := 0; i < cap(errs); i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            errs <- store.MarkProcessed(ctx, "n1")
+        }()
+    }
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        if err != nil {
+            t.Errorf("MarkProcessed: %v", err)
+        }
+    }
+    if ok, _ := store.Processed(ctx, "n1"); !ok {
+        t.Error("n1 not processed")
+    }
+}
@@ -4,25 +4,58 @@ import (
     "context"
 
     "github.com/yunlyz/go-wechat/wxpay/client"
+    "github.com/yunlyz/go-wechat/wxpay/common"
+    "github.com/yunlyz/go-wechat/wxpay/marketing/busifavor"
     "github.com/yunlyz/go-wechat/wxpay/marketing/favor"
+    "github.com/yunlyz/go-wechat/wxpay/notify"
 )
 
 type wxpay struct {
     common *client.Service
+    com    *common.Common
     fav    *favor.Favor
+    busi   *busifavor.BusiFavor
+}
+
+func (pay *wxpay) GetCommon() *common.Common {
+    return pay.com
 }
 
 func (pay *wxpay) GetFavor() *favor.Favor {
     return pay.fav
 }
 
-func New(mchId int64, serialNo, privateKey, publicKey string) *wxpay {
-    common := &client.Service{
-        Client: client.New(mchId, serialNo, privateKey, publicKey),
+func (pay *wxpay) GetBusiFavor() *busifavor.BusiFavor {
+    return pay.busi
+}
+
+// NotifyHandler creates the http.Handler of the notify url
+func (pay *wxpay) NotifyHandler(handler notify.HandlerFunc) *notify.Handler {
+    return notify.New(pay.common.Client, handler)
+}
+
+func New(mchId int64, serialNo, privateKey, publicKey string, opts ...client.Option) *wxpay {
+    return NewWithClient(client.New(mchId, serialNo, privateKey, publicKey, opts...))
+}
+
+// NewClient creates the SDK from client options, e.g. client.WithCredential and client.WithAPIv3Key
+func NewClient(mchId int64, opts ...client.Option) (pay *wxpay, err error) {
+    c, err := client.NewClient(mchId, opts...)
+    if err != nil {
+        return
+    }
+    return NewWithClient(c), nil
+}
+
+func NewWithClient(c *client.Client) *wxpay {
+    srv := &client.Service{
+        Client: c,
     }
     pay := &wxpay{}
-    pay.common = common
+    pay.common = srv
+    pay.com = common.New(pay.common)
     pay.fav = favor.New(context.Background(), pay.common)
+    pay.busi = busifavor.New(context.Background(), pay.common)
 
     return pay
 }